@@ -0,0 +1,45 @@
+// Package atomicfile writes files so a crash leaves either the old contents
+// or the new ones, never half of each.
+package atomicfile
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Replaces the file at `path` with whatever `write` writes. It's written to a
+// temporary file alongside, synced and then renamed over the top.
+func Write(path string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	// Does nothing once the rename has happened
+	defer os.Remove(tmp.Name())
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	// Make sure the rename itself survives a crash
+	dirFile, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer dirFile.Close()
+
+	return dirFile.Sync()
+}
@@ -0,0 +1,44 @@
+package atomicfile
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatalf("Failed to write test file, err: %v", err)
+	}
+
+	err := Write(path, func(w io.Writer) error {
+		_, err := w.Write([]byte("new"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Failed to write, err: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("File wasn't replaced. A: %q, E: %q", data, "new")
+	}
+
+	// A write that fails part way leaves the old file be, and nothing behind
+	failed := errors.New("failed")
+	err = Write(path, func(w io.Writer) error {
+		w.Write([]byte("half"))
+		return failed
+	})
+	if err != failed {
+		t.Errorf("Write didn't pass the error on. A: %v, E: %v", err, failed)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "new" {
+		t.Errorf("Failed write changed the file. A: %q, E: %q", data, "new")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Failed write left a temporary file behind. A: %d files, E: 1", len(entries))
+	}
+}
@@ -0,0 +1,75 @@
+// Package auth decides who's allowed to connect, and remembers the players
+// they've been.
+//
+// An Authenticator looks at the HTTP request a websocket connection starts
+// with and works out whose it is. Browsers can't set headers on a websocket
+// request, so credentials can come as a `token` query parameter as well as a
+// bearer Authorization header.
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var (
+	// The request didn't carry any credentials at all
+	ErrNoCredentials = errors.New("no credentials")
+	// The request carried credentials, but they're no good
+	ErrBadCredentials = errors.New("bad credentials")
+	// The credentials were good once but have run out
+	ErrExpired = errors.New("credentials have expired")
+)
+
+// Identity is who an authenticator decided a request came from
+type Identity struct {
+	// Stable and unique to the person, used to find their profile
+	Subject string
+	// What to call them in game. Empty leaves it to the client
+	Name string
+}
+
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// Pulls the token out of a request, from the Authorization header if it has
+// one and the `token` query parameter otherwise
+func Token(r *http.Request) (string, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return "", ErrBadCredentials
+		}
+		return token, nil
+	}
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token, nil
+	}
+
+	return "", ErrNoCredentials
+}
+
+// Chain tries each authenticator in turn and goes with the first that
+// recognises the request
+type Chain []Authenticator
+
+func (chain Chain) Authenticate(r *http.Request) (*Identity, error) {
+	err := ErrNoCredentials
+	for _, authenticator := range chain {
+		identity, tried := authenticator.Authenticate(r)
+		if tried == nil {
+			return identity, nil
+		}
+		// Keep the most useful reason for turning them away. Anything says more
+		// than no credentials, and anything specific says more than bad ones
+		switch {
+		case tried == ErrNoCredentials:
+		case err == ErrNoCredentials, err == ErrBadCredentials:
+			err = tried
+		}
+	}
+
+	return nil, err
+}
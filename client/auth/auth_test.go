@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToken(t *testing.T) {
+	cases := []struct {
+		header string
+		query  string
+		token  string
+		err    error
+	}{
+		{"Bearer abc", "", "abc", nil},
+		{"bearer abc", "def", "abc", nil},
+		{"", "def", "def", nil},
+		{"Basic abc", "", "", ErrBadCredentials},
+		{"", "", "", ErrNoCredentials},
+	}
+	for _, testCase := range cases {
+		r := httptest.NewRequest("GET", "/server?token="+testCase.query, nil)
+		if testCase.header != "" {
+			r.Header.Set("Authorization", testCase.header)
+		}
+
+		token, err := Token(r)
+		if token != testCase.token || err != testCase.err {
+			t.Errorf("Token read wrong. A: %q %v, E: %q %v", token, err, testCase.token, testCase.err)
+		}
+	}
+}
+
+func TestTokenFile(t *testing.T) {
+	tokens, err := ReadTokenFile(strings.NewReader(`
+# Friends
+abc alice Alice Liddell
+def bob
+`))
+	if err != nil {
+		t.Fatalf("Failed to read token file, err: %v", err)
+	}
+
+	r := httptest.NewRequest("GET", "/server?token=abc", nil)
+	identity, err := tokens.Authenticate(r)
+	if err != nil || identity.Subject != "alice" || identity.Name != "Alice Liddell" {
+		t.Errorf("Wrong identity. A: %+v %v, E: alice, Alice Liddell", identity, err)
+	}
+	r = httptest.NewRequest("GET", "/server?token=abd", nil)
+	if _, err := tokens.Authenticate(r); err != ErrBadCredentials {
+		t.Errorf("Unknown token let in. A: %v, E: %v", err, ErrBadCredentials)
+	}
+
+	if _, err := ReadTokenFile(strings.NewReader("abc alice\nabc bob\n")); err == nil {
+		t.Errorf("Token listed twice was accepted")
+	}
+	if _, err := ReadTokenFile(strings.NewReader("abc\n")); err == nil {
+		t.Errorf("Token without a subject was accepted")
+	}
+}
+
+func TestHMAC(t *testing.T) {
+	signer := NewHMAC([]byte("0123456789abcdef0123456789abcdef"))
+	now := time.Unix(1700000000, 0)
+	signer.now = func() time.Time { return now }
+
+	token, err := signer.Sign(Claims{Subject: "alice", Name: "Alice", Expires: now.Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatalf("Failed to sign, err: %v", err)
+	}
+	r := httptest.NewRequest("GET", "/server", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	identity, err := signer.Authenticate(r)
+	if err != nil || identity.Subject != "alice" || identity.Name != "Alice" {
+		t.Errorf("Signed token wasn't accepted. A: %+v %v", identity, err)
+	}
+
+	// Another secret's tokens don't work
+	other := NewHMAC([]byte("fedcba9876543210fedcba9876543210"))
+	if _, err := other.Verify(token); err != ErrBadCredentials {
+		t.Errorf("Token verified with the wrong secret. A: %v, E: %v", err, ErrBadCredentials)
+	}
+
+	// Nor do tampered ones
+	segments := strings.Split(token, ".")
+	forged, _ := signer.Sign(Claims{Subject: "mallory"})
+	segments[1] = strings.Split(forged, ".")[1]
+	if _, err := signer.Verify(strings.Join(segments, ".")); err != ErrBadCredentials {
+		t.Errorf("Tampered token verified. A: %v, E: %v", err, ErrBadCredentials)
+	}
+
+	// Nor do expired ones
+	now = now.Add(2 * time.Hour)
+	if _, err := signer.Verify(token); err != ErrExpired {
+		t.Errorf("Expired token verified. A: %v, E: %v", err, ErrExpired)
+	}
+}
+
+func TestChain(t *testing.T) {
+	tokens, _ := ReadTokenFile(strings.NewReader("abc alice\n"))
+	signer := NewHMAC([]byte("0123456789abcdef0123456789abcdef"))
+	chain := Chain{tokens, signer}
+
+	signed, _ := signer.Sign(Claims{Subject: "bob"})
+	for token, subject := range map[string]string{"abc": "alice", signed: "bob"} {
+		r := httptest.NewRequest("GET", "/server?token="+token, nil)
+		identity, err := chain.Authenticate(r)
+		if err != nil || identity.Subject != subject {
+			t.Errorf("Chain didn't find the right identity. A: %+v %v, E: %s", identity, err, subject)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/server?token=nope", nil)
+	if _, err := chain.Authenticate(r); err != ErrBadCredentials {
+		t.Errorf("Chain let in a bad token. A: %v, E: %v", err, ErrBadCredentials)
+	}
+	r = httptest.NewRequest("GET", "/server", nil)
+	if _, err := chain.Authenticate(r); err != ErrNoCredentials {
+		t.Errorf("Chain gave the wrong reason. A: %v, E: %v", err, ErrNoCredentials)
+	}
+}
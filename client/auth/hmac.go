@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Claims are what a signed token says about who holds it. They're a subset
+// of the standard JWT claims, so tokens can come from any JWT library that
+// does HS256.
+type Claims struct {
+	Subject string `json:"sub"`
+	Name    string `json:"name,omitempty"`
+	// Unix seconds. Zero means the token never expires
+	Expires   int64 `json:"exp,omitempty"`
+	NotBefore int64 `json:"nbf,omitempty"`
+	IssuedAt  int64 `json:"iat,omitempty"`
+}
+
+type tokenHeader struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+}
+
+// How much clocks are allowed to disagree when checking exp and nbf
+const clockSkew = 30 * time.Second
+
+// HMAC lets in anyone holding a token signed with the shared secret, checked
+// locally without asking anyone else. Whatever hands out tokens, a login
+// page say, only needs to know the same secret.
+//
+// Tokens are JWTs signed with HS256: a header, the claims and the signature,
+// each base64url encoded without padding and joined with dots.
+type HMAC struct {
+	secret []byte
+	// Stands in for time.Now so tests can move the clock
+	now func() time.Time
+}
+
+func NewHMAC(secret []byte) *HMAC {
+	return &HMAC{secret: secret, now: time.Now}
+}
+
+// Makes a token for `claims` that Authenticate will accept
+func (h *HMAC) Sign(claims Claims) (string, error) {
+	header, err := json.Marshal(tokenHeader{Algorithm: "HS256", Type: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := encodeSegment(header) + "." + encodeSegment(payload)
+	return signed + "." + encodeSegment(h.signature(signed)), nil
+}
+
+func (h *HMAC) Authenticate(r *http.Request) (*Identity, error) {
+	token, err := Token(r)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := h.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Identity{Subject: claims.Subject, Name: claims.Name}, nil
+}
+
+// Checks a token's signature and dates, and returns what it claims
+func (h *HMAC) Verify(token string) (*Claims, error) {
+	segments := strings.Split(token, ".")
+	if len(segments) != 3 {
+		return nil, ErrBadCredentials
+	}
+
+	signature, err := decodeSegment(segments[2])
+	if err != nil {
+		return nil, ErrBadCredentials
+	}
+	if !hmac.Equal(signature, h.signature(segments[0]+"."+segments[1])) {
+		return nil, ErrBadCredentials
+	}
+
+	// Only look inside once we know we wrote it
+	header := tokenHeader{}
+	if err := decodeJSONSegment(segments[0], &header); err != nil || header.Algorithm != "HS256" {
+		return nil, ErrBadCredentials
+	}
+	claims := &Claims{}
+	if err := decodeJSONSegment(segments[1], claims); err != nil || claims.Subject == "" {
+		return nil, ErrBadCredentials
+	}
+
+	now := h.now()
+	if claims.Expires != 0 && now.Add(-clockSkew).Unix() >= claims.Expires {
+		return nil, ErrExpired
+	}
+	if claims.NotBefore != 0 && now.Add(clockSkew).Unix() < claims.NotBefore {
+		return nil, errors.New("token isn't valid yet")
+	}
+
+	return claims, nil
+}
+
+func (h *HMAC) signature(signed string) []byte {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(signed))
+
+	return mac.Sum(nil)
+}
+
+func encodeSegment(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeSegment(segment string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(segment)
+}
+
+func decodeJSONSegment(segment string, into interface{}) error {
+	data, err := decodeSegment(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, into)
+}
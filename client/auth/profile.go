@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VivaLaPanda/antipath/atomicfile"
+	"github.com/VivaLaPanda/antipath/entity"
+)
+
+// Profile is what we remember about someone between visits
+type Profile struct {
+	Subject string
+	Name    string
+	// The player they had last time. It may be long gone, in which case
+	// they get a new one
+	PlayerID  entity.ID
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// Profiles keeps a profile for everyone who's signed in, written through to
+// a JSON file so they outlive the server
+type Profiles struct {
+	lock     sync.Mutex
+	path     string
+	profiles map[string]*Profile
+}
+
+// Opens the profiles stored at `path`, starting an empty set if there's no
+// file yet. An empty path keeps them in memory only.
+func OpenProfiles(path string) (*Profiles, error) {
+	profiles := &Profiles{path: path, profiles: make(map[string]*Profile)}
+	if path == "" {
+		return profiles, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return profiles, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	saved := []*Profile{}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("couldn't read profiles, err: %s", err)
+	}
+	for _, profile := range saved {
+		profiles.profiles[profile.Subject] = profile
+	}
+
+	return profiles, nil
+}
+
+// Looks up the profile for `identity`, making one if they're new. The name
+// is refreshed if the identity carries one.
+func (profiles *Profiles) Get(identity *Identity) Profile {
+	profiles.lock.Lock()
+	defer profiles.lock.Unlock()
+
+	profile, exists := profiles.profiles[identity.Subject]
+	if !exists {
+		profile = &Profile{Subject: identity.Subject, FirstSeen: time.Now()}
+		profiles.profiles[identity.Subject] = profile
+	}
+	if identity.Name != "" {
+		profile.Name = identity.Name
+	}
+
+	return *profile
+}
+
+// Records which player `subject` is playing as, and writes the profiles out
+func (profiles *Profiles) Played(subject string, playerID entity.ID, name string) error {
+	profiles.lock.Lock()
+	defer profiles.lock.Unlock()
+
+	profile, exists := profiles.profiles[subject]
+	if !exists {
+		profile = &Profile{Subject: subject, FirstSeen: time.Now()}
+		profiles.profiles[subject] = profile
+	}
+	profile.PlayerID = playerID
+	profile.Name = name
+	profile.LastSeen = time.Now()
+
+	return profiles.save()
+}
+
+// Writes every profile out atomically. Callers must hold lock
+func (profiles *Profiles) save() error {
+	if profiles.path == "" {
+		return nil
+	}
+
+	saved := make([]*Profile, 0, len(profiles.profiles))
+	for _, profile := range profiles.profiles {
+		saved = append(saved, profile)
+	}
+	sort.Slice(saved, func(i, j int) bool { return saved[i].Subject < saved[j].Subject })
+	data, err := json.MarshalIndent(saved, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.Write(profiles.path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	profiles, err := OpenProfiles(path)
+	if err != nil {
+		t.Fatalf("Failed to open profiles, err: %v", err)
+	}
+
+	profile := profiles.Get(&Identity{Subject: "alice", Name: "Alice"})
+	if profile.Name != "Alice" || profile.PlayerID != "" {
+		t.Errorf("New profile is wrong. A: %+v", profile)
+	}
+	if err := profiles.Played("alice", "player-1", "Alice"); err != nil {
+		t.Fatalf("Failed to save profiles, err: %v", err)
+	}
+
+	reopened, err := OpenProfiles(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen profiles, err: %v", err)
+	}
+	// No name in the identity keeps the one we had
+	profile = reopened.Get(&Identity{Subject: "alice"})
+	if profile.PlayerID != "player-1" || profile.Name != "Alice" {
+		t.Errorf("Profile didn't survive a restart. A: %+v, E: player-1, Alice", profile)
+	}
+	if profile.FirstSeen.IsZero() || profile.LastSeen.IsZero() {
+		t.Errorf("Profile lost its dates. A: %+v", profile)
+	}
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// TokenFile lets in anyone holding one of a fixed set of tokens. Good for a
+// handful of friends or a private test server.
+//
+// The file has one token per line: the token, the subject it belongs to,
+// and optionally a name, separated by whitespace. The name is the rest of the
+// line, so it can have spaces in it. Blank lines and lines starting with #
+// are skipped.
+type TokenFile struct {
+	// Keyed by a hash of the token so lookups don't leak how much of a
+	// guess was right
+	identities map[[sha256.Size]byte]*Identity
+}
+
+func LoadTokenFile(path string) (*TokenFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadTokenFile(file)
+}
+
+func ReadTokenFile(r io.Reader) (*TokenFile, error) {
+	tokens := &TokenFile{identities: make(map[[sha256.Size]byte]*Identity)}
+	subjects := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: need a token and a subject", line)
+		}
+		identity := &Identity{Subject: fields[1]}
+		if len(fields) > 2 {
+			_, rest, _ := strings.Cut(text, fields[0])
+			_, rest, _ = strings.Cut(rest, fields[1])
+			identity.Name = strings.TrimSpace(rest)
+		}
+
+		key := sha256.Sum256([]byte(fields[0]))
+		if _, taken := tokens.identities[key]; taken {
+			return nil, fmt.Errorf("line %d: token is listed twice", line)
+		}
+		if subjects[identity.Subject] {
+			return nil, fmt.Errorf("line %d: subject %q already has a token", line, identity.Subject)
+		}
+		tokens.identities[key] = identity
+		subjects[identity.Subject] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+func (tokens *TokenFile) Authenticate(r *http.Request) (*Identity, error) {
+	token, err := Token(r)
+	if err != nil {
+		return nil, err
+	}
+
+	identity, known := tokens.identities[sha256.Sum256([]byte(token))]
+	if !known {
+		return nil, ErrBadCredentials
+	}
+
+	found := *identity
+	return &found, nil
+}
@@ -0,0 +1,336 @@
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/VivaLaPanda/antipath/engine/action"
+	"github.com/VivaLaPanda/antipath/entity"
+	"github.com/VivaLaPanda/antipath/entity/player"
+	"github.com/VivaLaPanda/antipath/entity/projectile"
+	"github.com/VivaLaPanda/antipath/state"
+	"github.com/VivaLaPanda/antipath/state/tile"
+	"github.com/gorilla/websocket"
+)
+
+// The binary protocol. Every number is a varint, signed ones zigzag encoded.
+// Strings are a length followed by the bytes.
+//
+// Entity IDs are sent once per message. The first time an ID appears it's
+// written as 0 followed by the string, after that as its 1-based position in
+// the order IDs first appeared.
+//
+// An update is:
+//
+//	version (the protocol version agreed in the handshake)
+//	kind: 0 keyframe, 1 delta
+//	client ID
+//	has player (0/1), then the player if there is one
+//	last input applied (version 2 on)
+//	keyframe: tick, root x, root y, width, height, every tile in reading
+//	          order, entity count, then each entity as ID, x, y
+//	delta:    tick, base, root x, root y, width, height, change count, then
+//	          each change as x, y, tile, moved count, then each as ID, x, y,
+//	          removed count, then each removed ID
+//	event count, then each event as kind string, tick, attacker ID, victim ID,
+//	damage, has pos (0/1), x, y
+//
+// A tile is alignment, height, totem health, then what's on it: 0 nothing,
+// 1 a player, 2 a projectile, followed by that entity.
+//
+// A player is ID, name, health, alignment, speed, height, jump height, altitude.
+// A projectile is ID, owner ID, direction, altitude, height.
+//
+// Clients send:
+//
+//	flags: 1 has an action, 2 jump, 4 resync
+//	ack
+//	action (if flagged): seq (version 2 on), movement x, movement y, attack,
+//	                     attack dir, place totem
+
+const (
+	keyframeUpdate = iota
+	deltaUpdate
+)
+
+const (
+	noEntity = iota
+	playerEntity
+	projectileEntity
+)
+
+const (
+	flagAction = 1 << iota
+	flagJump
+	flagResync
+)
+
+// The oldest version with input sequence numbers
+const sequencedVersion = 2
+
+type binaryCodec struct {
+	// The protocol version agreed with the client
+	version int
+}
+
+func (binaryCodec) messageType() int {
+	return websocket.BinaryMessage
+}
+
+func (codec binaryCodec) encodeUpdate(message *serverMessage) ([]byte, error) {
+	out := newBinaryWriter()
+	out.uint(uint64(codec.version))
+
+	if message.Delta != nil {
+		out.uint(deltaUpdate)
+	} else {
+		out.uint(keyframeUpdate)
+	}
+	out.id(message.ClientID)
+	if message.ClientData != nil {
+		out.uint(1)
+		out.player(message.ClientData)
+	} else {
+		out.uint(0)
+	}
+	if codec.version >= sequencedVersion {
+		out.uint(message.LastInput)
+	}
+
+	if message.Delta != nil {
+		if err := out.delta(message.Delta); err != nil {
+			return nil, err
+		}
+	} else if message.GameState != nil {
+		if err := out.state(message.GameState); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, errors.New("update has neither a state nor a delta")
+	}
+
+	out.uint(uint64(len(message.Events)))
+	for _, event := range message.Events {
+		out.string(string(event.Kind))
+		out.uint(event.Tick)
+		out.id(event.Attacker)
+		out.id(event.Victim)
+		out.uint(uint64(event.Damage))
+		if event.Pos != nil {
+			out.uint(1)
+			out.pos(*event.Pos)
+		} else {
+			out.uint(0)
+		}
+	}
+
+	return out.buf.Bytes(), nil
+}
+
+func (codec binaryCodec) decodeMessage(data []byte) (*clientMessage, error) {
+	in := bytes.NewReader(data)
+	message := &clientMessage{}
+
+	flags, err := binary.ReadUvarint(in)
+	if err != nil {
+		return nil, err
+	}
+	if message.Ack, err = binary.ReadUvarint(in); err != nil {
+		return nil, err
+	}
+	message.Resync = flags&flagResync != 0
+	if flags&flagAction == 0 {
+		return message, nil
+	}
+
+	var seq uint64
+	if codec.version >= sequencedVersion {
+		if seq, err = binary.ReadUvarint(in); err != nil {
+			return nil, fmt.Errorf("action is cut short, err: %s", err)
+		}
+	}
+	fields := make([]int64, 5)
+	for idx := range fields {
+		if fields[idx], err = binary.ReadVarint(in); err != nil {
+			return nil, fmt.Errorf("action is cut short, err: %s", err)
+		}
+	}
+	message.Set = &action.Set{
+		Seq:        seq,
+		Movement:   state.Coordinates{X: int(fields[0]), Y: int(fields[1])},
+		Jump:       flags&flagJump != 0,
+		Attack:     int(fields[2]),
+		AttackDir:  state.Direction(fields[3]),
+		PlaceTotem: int(fields[4]),
+	}
+
+	return message, nil
+}
+
+// Encodes a client message the way decodeMessage reads it. Handy for bots and
+// tests written in Go.
+func (codec binaryCodec) encodeMessage(message *clientMessage) []byte {
+	out := newBinaryWriter()
+	var flags uint64
+	if message.Set != nil {
+		flags |= flagAction
+		if message.Set.Jump {
+			flags |= flagJump
+		}
+	}
+	if message.Resync {
+		flags |= flagResync
+	}
+	out.uint(flags)
+	out.uint(message.Ack)
+
+	if message.Set != nil {
+		if codec.version >= sequencedVersion {
+			out.uint(message.Set.Seq)
+		}
+		out.pos(message.Set.Movement)
+		out.int(int64(message.Set.Attack))
+		out.int(int64(message.Set.AttackDir))
+		out.int(int64(message.Set.PlaceTotem))
+	}
+
+	return out.buf.Bytes()
+}
+
+type binaryWriter struct {
+	buf     *bytes.Buffer
+	ids     map[entity.ID]uint64
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func newBinaryWriter() *binaryWriter {
+	return &binaryWriter{buf: &bytes.Buffer{}, ids: make(map[entity.ID]uint64)}
+}
+
+func (out *binaryWriter) uint(value uint64) {
+	n := binary.PutUvarint(out.scratch[:], value)
+	out.buf.Write(out.scratch[:n])
+}
+
+func (out *binaryWriter) int(value int64) {
+	n := binary.PutVarint(out.scratch[:], value)
+	out.buf.Write(out.scratch[:n])
+}
+
+func (out *binaryWriter) string(value string) {
+	out.uint(uint64(len(value)))
+	out.buf.WriteString(value)
+}
+
+func (out *binaryWriter) id(id entity.ID) {
+	if ref, seen := out.ids[id]; seen {
+		out.uint(ref)
+		return
+	}
+
+	out.ids[id] = uint64(len(out.ids) + 1)
+	out.uint(0)
+	out.string(string(id))
+}
+
+func (out *binaryWriter) pos(pos state.Coordinates) {
+	out.int(int64(pos.X))
+	out.int(int64(pos.Y))
+}
+
+func (out *binaryWriter) player(p *player.Player) {
+	out.id(p.PlayerID)
+	out.string(p.Name)
+	out.uint(uint64(p.Health))
+	out.int(int64(p.Alignment()))
+	out.int(int64(p.Speed()))
+	out.int(int64(p.Height()))
+	out.int(int64(p.JumpHeight()))
+	out.int(int64(p.Altitude))
+}
+
+func (out *binaryWriter) tile(t *tile.Tile) error {
+	out.int(int64(t.Alignment()))
+	out.int(int64(t.TerrainHeight()))
+	out.int(int64(t.TotemHealth()))
+
+	switch standing := t.PeekEntity().(type) {
+	case nil:
+		out.uint(noEntity)
+	case *player.Player:
+		out.uint(playerEntity)
+		out.player(standing)
+	case *projectile.Projectile:
+		out.uint(projectileEntity)
+		out.id(standing.ProjectileID)
+		out.id(standing.Owner)
+		out.int(int64(standing.Direction))
+		out.int(int64(standing.Altitude))
+		out.int(int64(standing.Height()))
+	default:
+		return fmt.Errorf("don't know how to encode entity %T", standing)
+	}
+
+	return nil
+}
+
+func (out *binaryWriter) state(s *state.State) error {
+	root := s.Root()
+	width, height := 0, 0
+	s.EachTile(func(pos state.Coordinates, t *tile.Tile) {
+		width, height = pos.X-root.X+1, pos.Y-root.Y+1
+	})
+
+	out.uint(s.Tick())
+	out.pos(root)
+	out.uint(uint64(width))
+	out.uint(uint64(height))
+
+	var err error
+	s.EachTile(func(pos state.Coordinates, t *tile.Tile) {
+		if err == nil {
+			err = out.tile(t)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	entities := s.Entities()
+	out.uint(uint64(len(entities)))
+	for _, id := range sortedEntityIDs(entities) {
+		out.id(id)
+		out.pos(entities[id])
+	}
+
+	return nil
+}
+
+func (out *binaryWriter) delta(delta *Delta) error {
+	out.uint(delta.Tick)
+	out.uint(delta.Base)
+	out.pos(delta.Root)
+	out.uint(uint64(delta.Width))
+	out.uint(uint64(delta.Height))
+
+	out.uint(uint64(len(delta.Tiles)))
+	for _, change := range delta.Tiles {
+		out.pos(change.Pos)
+		if err := out.tile(change.Tile); err != nil {
+			return err
+		}
+	}
+	out.uint(uint64(len(delta.Entities)))
+	for _, id := range sortedEntityIDs(delta.Entities) {
+		out.id(id)
+		out.pos(delta.Entities[id])
+	}
+	out.uint(uint64(len(delta.Removed)))
+	for _, id := range delta.Removed {
+		out.id(id)
+	}
+
+	return nil
+}
@@ -1,16 +1,17 @@
 package client
 
 import (
-	"encoding/json"
+	"context"
 	"log"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/VivaLaPanda/antipath/client/auth"
 	"github.com/VivaLaPanda/antipath/engine"
 	"github.com/VivaLaPanda/antipath/engine/action"
 	"github.com/VivaLaPanda/antipath/entity"
-	"github.com/VivaLaPanda/antipath/entity/player"
-	"github.com/VivaLaPanda/antipath/state"
 	"github.com/gorilla/websocket"
 )
 
@@ -26,6 +27,10 @@ const (
 
 	// Maximum message size allowed from peer.
 	maxMessageSize = 512
+
+	// How many updates can wait to be written. Once it's full the engine
+	// throws away all but the latest
+	sendQueue = 4
 )
 
 var (
@@ -33,10 +38,8 @@ var (
 	space   = []byte{' '}
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-}
+// Tracks every connection that's still writing so shutdown can wait on them
+var connections sync.WaitGroup
 
 // Client is a middleman between the websocket connection and the hub.
 type Client struct {
@@ -45,20 +48,133 @@ type Client struct {
 	engine   *engine.Engine
 	playerID entity.ID
 
-	// Buffered channel of outbound messages.
-	stateReciever chan *state.State
+	// Buffered channel of outbound messages. The engine keeps it to the
+	// latest updates if we fall behind
+	stateReciever chan *engine.Update
+
+	// What we've sent the client, so updates can go out as just the changes.
+	// Nil unless the client said it can handle deltas
+	deltas *deltaEncoder
+
+	// How messages are put on the wire, agreed when the connection was made
+	codec codec
+
+	// Set once another connection has taken over this player
+	replaced atomic.Bool
+	// The sessions for the engine's players
+	sessions *sessionStore
 }
 
-func NewClient(conn *websocket.Conn, e *engine.Engine) *Client {
+// What clients send us. The action fields sit at the top level, so a plain
+// action.Set still works, and a message with just an ack doesn't touch the
+// player's action.
+type clientMessage struct {
+	*action.Set
+	// The tick of the last update the client received
+	Ack uint64
+	// Asks for the next update to be a keyframe
+	Resync bool
+}
+
+// Adds a player for a client that's completed its handshake, and welcomes it
+func NewClient(conn *websocket.Conn, e *engine.Engine, handshake *Handshake) (*Client, error) {
+	return newClient(conn, e, handshake, nil)
+}
+
+// `profile` is who the client signed in as, or nil if they didn't
+func newClient(conn *websocket.Conn, e *engine.Engine, handshake *Handshake, profile *auth.Profile) (*Client, error) {
 	client := &Client{
 		conn:          conn,
 		engine:        e,
-		stateReciever: make(chan *state.State),
+		stateReciever: make(chan *engine.Update, sendQueue),
+		codec:         codecFor(handshake),
+		sessions:      sessionsFor(e),
+	}
+	if handshake.has(DeltaCapability) {
+		client.deltas = newDeltaEncoder()
+	}
+
+	// Pick up where they left off if we can, otherwise they start afresh.
+	// Signed in players get their profile's player back, anyone else needs
+	// the session token they were given
+	token := handshake.Session
+	playerID, known := client.sessions.lookup(token)
+	if profile != nil {
+		if playerID != profile.PlayerID {
+			// A session for someone else's player is no good to them
+			token = ""
+		}
+		// Only if it's still their player. A world started over from the
+		// same seed hands the same IDs out to whoever joins
+		playerID = profile.PlayerID
+		known = playerID != "" && e.Owner(playerID) == profile.Subject
+	}
+	resumed := false
+	if known {
+		// Take over their updates before checking they're still around, so
+		// the connection we're replacing can't disconnect them after we have
+		client.sessions.bind(playerID, client)
+		e.RegisterClient(playerID, client.stateReciever)
+		if e.ReconnectPlayer(playerID) {
+			client.playerID = playerID
+			resumed = true
+		} else {
+			// Their grace period ran out, the token is no good any more
+			e.UnregisterClient(playerID, client.stateReciever)
+			client.sessions.release(playerID, client)
+			client.sessions.forget(token)
+			client.stateReciever = make(chan *engine.Update, sendQueue)
+		}
+	}
+	if !resumed {
+		playerID, err := e.AddNamedPlayer(handshake.Name)
+		if err != nil {
+			// Most likely the world's full, they can try again later
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "no room to join"), time.Now().Add(writeWait))
+			return nil, err
+		}
+		client.playerID = playerID
+		if profile != nil {
+			e.SetOwner(playerID, profile.Subject)
+		}
+		token = ""
+		client.sessions.bind(client.playerID, client)
+		e.RegisterClient(client.playerID, client.stateReciever)
+	}
+	if token == "" {
+		var err error
+		if token, err = client.sessions.issue(client.playerID); err != nil {
+			client.hangUp()
+			return nil, err
+		}
 	}
 
-	client.playerID = e.AddPlayer()
+	conn.SetWriteDeadline(time.Now().Add(writeWait))
+	err := conn.WriteJSON(&Welcome{
+		Version:      ProtocolVersion,
+		Encoding:     handshake.Encoding,
+		ClientID:     client.playerID,
+		Capabilities: handshake.Capabilities,
+		WindowSize:   e.WindowSize,
+		Session:      token,
+		Resumed:      resumed,
+	})
+	if err != nil {
+		client.hangUp()
+		return nil, err
+	}
+
+	return client, nil
+}
 
-	return client
+// Lets go of the player, disconnecting them unless another connection has
+// taken them over, or the engine already has
+func (c *Client) hangUp() {
+	c.sessions.release(c.playerID, c)
+	if c.engine.UnregisterClient(c.playerID, c.stateReciever) {
+		c.engine.DisconnectPlayer(c.playerID)
+	}
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -74,7 +190,7 @@ func (c *Client) readPump() {
 	c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 	for {
-		_, actionJSON, err := c.conn.ReadMessage()
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("error: %v", err)
@@ -82,58 +198,77 @@ func (c *Client) readPump() {
 			break
 		}
 
-		// Take the message, parse JSON, send as Action to engine
-		action := &action.Set{}
-		err = json.Unmarshal(actionJSON, action)
+		// Take the message, parse it, send as Action to engine
+		message, err := c.codec.decodeMessage(data)
 		if err != nil {
 			log.Printf("error parsing user command: %v", err)
+			continue
 		}
 
-		c.engine.SetAction(c.playerID, *action)
+		if c.deltas != nil {
+			if message.Resync {
+				c.deltas.Reset()
+			} else if message.Ack != 0 {
+				c.deltas.Ack(message.Ack)
+			}
+		}
+		if message.Set != nil {
+			c.engine.SetAction(c.playerID, *message.Set)
+		}
 	}
 }
 
 func (c *Client) writePump() {
 	ticker := time.NewTicker(pingPeriod)
 	defer func() {
-		c.engine.UnregisterClient(c.playerID)
+		// If someone else has taken over the player, leave them be
+		c.hangUp()
 		ticker.Stop()
 		c.conn.Close()
+		connections.Done()
 	}()
 	// Loop reading current game state
 	for {
 		select {
-		case stateSnapshot, ok := <-c.stateReciever:
+		case update, ok := <-c.stateReciever:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			if !ok {
-				// The channel is closed.
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				// The engine hung up on us, because another connection took
+				// over, because it's shutting down or because we fell too far
+				// behind
+				if c.replaced.Load() {
+					c.conn.WriteMessage(websocket.CloseMessage,
+						websocket.FormatCloseMessage(CloseReplaced, "replaced by another connection"))
+				} else if c.engine.Stopped() {
+					c.conn.WriteMessage(websocket.CloseMessage,
+						websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"))
+				} else {
+					c.conn.WriteMessage(websocket.CloseMessage,
+						websocket.FormatCloseMessage(CloseTooSlow, "fell too far behind"))
+				}
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
+			var delta *Delta
+			if c.deltas != nil {
+				delta = c.deltas.Encode(update.State)
 			}
-
-			clientState := struct {
-				ClientData *player.Player
-				ClientID   entity.ID
-				GameState  *state.State
-			}{
-				ClientData: c.engine.GetPlayer(c.playerID),
+			clientState := &serverMessage{
+				ClientData: update.Player,
 				ClientID:   c.playerID,
-				GameState:  stateSnapshot,
+				Delta:      delta,
+				Events:     update.Events,
+				LastInput:  update.LastInput,
+			}
+			if delta == nil {
+				clientState.GameState = update.State
 			}
-			stateString, err := json.Marshal(clientState)
+			encoded, err := c.codec.encodeUpdate(clientState)
 			if err != nil {
+				log.Printf("Failed to encode update for %v: %v", c.playerID, err)
 				return
 			}
-
-			// Need to implement actual JSON encoding logic
-			w.Write(stateString)
-
-			if err := w.Close(); err != nil {
+			if err := c.conn.WriteMessage(c.codec.messageType(), encoded); err != nil {
 				return
 			}
 		case <-ticker.C:
@@ -145,27 +280,26 @@ func (c *Client) writePump() {
 	}
 }
 
-// serveWs handles websocket requests from the peer.
+// serveWs handles websocket requests from the peer. Anyone can connect, as
+// long as they come from a page on the same host. Use a Server to choose who
+// gets in.
 func ServeWs(e *engine.Engine, w http.ResponseWriter, r *http.Request) {
-	log.Println("Client attempting to connect...")
-	// No same origin policy
-	upgrader.CheckOrigin = func(r *http.Request) bool {
-		return true
-	}
+	NewServer(e).ServeHTTP(w, r)
+}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Println(err)
-		return
+// Shutdown waits for every connected client to say goodbye. Clients hang up
+// once the engine they're subscribed to is stopped, so stop the engine first.
+func Shutdown(ctx context.Context) error {
+	finished := make(chan struct{})
+	go func() {
+		connections.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	// Make the client
-	client := NewClient(conn, e)
-	// Register it with the engine
-	client.engine.RegisterClient(client.playerID, client.stateReciever)
-
-	// Allow collection of memory referenced by the caller by doing all work in
-	// new goroutines.
-	go client.writePump()
-	go client.readPump()
-	log.Printf("Client connected and in game. ID: %v", client.playerID)
 }
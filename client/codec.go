@@ -0,0 +1,64 @@
+package client
+
+import (
+	"encoding/json"
+
+	"github.com/VivaLaPanda/antipath/engine"
+	"github.com/VivaLaPanda/antipath/entity"
+	"github.com/VivaLaPanda/antipath/entity/player"
+	"github.com/VivaLaPanda/antipath/state"
+	"github.com/gorilla/websocket"
+)
+
+// Websocket subprotocols clients can ask for. Clients that don't ask for one
+// get JSON, so plain browser clients keep working.
+const (
+	JSONProtocol   = "antipath.json"
+	BinaryProtocol = "antipath.binary"
+)
+
+// What gets sent to a client each tick
+type serverMessage struct {
+	ClientData *player.Player
+	ClientID   entity.ID
+	// Keyframes carry the whole state, deltas just what changed
+	GameState *state.State `json:",omitempty"`
+	Delta     *Delta       `json:",omitempty"`
+	Events    []engine.Event
+	// The last of the client's inputs that's been applied
+	LastInput uint64
+}
+
+// A codec turns messages into bytes on the wire and back
+type codec interface {
+	// The websocket message type to send encoded updates as
+	messageType() int
+	encodeUpdate(message *serverMessage) ([]byte, error)
+	decodeMessage(data []byte) (*clientMessage, error)
+}
+
+// Picks the codec for the encoding and version agreed in the handshake
+func codecFor(handshake *Handshake) codec {
+	if handshake.Encoding == BinaryEncoding {
+		return binaryCodec{version: handshake.Version}
+	}
+
+	return jsonCodec{}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) messageType() int {
+	return websocket.TextMessage
+}
+
+func (jsonCodec) encodeUpdate(message *serverMessage) ([]byte, error) {
+	return json.Marshal(message)
+}
+
+func (jsonCodec) decodeMessage(data []byte) (*clientMessage, error) {
+	message := &clientMessage{}
+	err := json.Unmarshal(data, message)
+
+	return message, err
+}
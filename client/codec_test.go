@@ -0,0 +1,139 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VivaLaPanda/antipath/engine"
+	"github.com/VivaLaPanda/antipath/engine/action"
+	"github.com/VivaLaPanda/antipath/entity/player"
+	"github.com/VivaLaPanda/antipath/state"
+	"github.com/gorilla/websocket"
+)
+
+func TestDecodeMessage(t *testing.T) {
+	sent := &clientMessage{
+		Set: &action.Set{Seq: 7, Movement: state.Coordinates{X: 3, Y: 4}, Jump: true, Attack: action.RangedAttack, AttackDir: state.Left, PlaceTotem: -1},
+		Ack: 99,
+	}
+	codec := binaryCodec{version: ProtocolVersion}
+	received, err := codec.decodeMessage(codec.encodeMessage(sent))
+	if err != nil {
+		t.Fatalf("Failed to decode binary message, err: %v", err)
+	}
+	if *received.Set != *sent.Set || received.Ack != sent.Ack {
+		t.Errorf("Binary message changed on the way through. A: %v %v, E: %v %v", received.Set, received.Ack, sent.Set, sent.Ack)
+	}
+
+	// Version 1 clients don't number their inputs
+	oldCodec := binaryCodec{version: 1}
+	received, err = oldCodec.decodeMessage(oldCodec.encodeMessage(sent))
+	if err != nil || received.Set.Seq != 0 || received.Set.Movement != sent.Set.Movement {
+		t.Errorf("Version 1 message decoded wrong. A: %v %v", received.Set, err)
+	}
+
+	// JSON clients put the sequence number alongside the action
+	received, _ = jsonCodec{}.decodeMessage([]byte(`{"Seq": 3, "Movement": {"X": 1, "Y": 2}}`))
+	if received.Set == nil || received.Set.Seq != 3 {
+		t.Errorf("JSON sequence number wasn't decoded. A: %v", received.Set)
+	}
+
+	// Old clients just send an action
+	received, _ = jsonCodec{}.decodeMessage([]byte(`{"Movement": {"X": 1, "Y": 2}, "Jump": true}`))
+	if received.Set == nil || received.Set.Movement != (state.Coordinates{X: 1, Y: 2}) || !received.Set.Jump {
+		t.Errorf("Plain JSON action wasn't decoded. A: %v", received.Set)
+	}
+
+	// And an ack on its own doesn't touch the action
+	received, _ = jsonCodec{}.decodeMessage([]byte(`{"Ack": 5}`))
+	if received.Set != nil || received.Ack != 5 {
+		t.Errorf("Ack only message decoded wrong. Set: %v, Ack: %d", received.Set, received.Ack)
+	}
+}
+
+func TestEncodeUpdate(t *testing.T) {
+	world := state.NewState(50)
+	clientData := player.NewPlayer()
+	playerID, _ := world.NewEntity(clientData, state.Coordinates{X: 25, Y: 25})
+	clientData.PlayerID = playerID
+	message := &serverMessage{
+		ClientData: clientData,
+		ClientID:   playerID,
+		GameState:  world.PeekState(playerID, 40),
+		Events:     []engine.Event{{Kind: engine.Hit, Tick: 1, Attacker: playerID, Damage: 10}},
+	}
+
+	jsonUpdate, err := jsonCodec{}.encodeUpdate(message)
+	if err != nil {
+		t.Fatalf("Failed to encode JSON update, err: %v", err)
+	}
+	binaryUpdate, err := binaryCodec{version: ProtocolVersion}.encodeUpdate(message)
+	if err != nil {
+		t.Fatalf("Failed to encode binary update, err: %v", err)
+	}
+	if len(binaryUpdate)*10 > len(jsonUpdate) {
+		t.Errorf("Binary update isn't much smaller than JSON. Binary: %d, JSON: %d", len(binaryUpdate), len(jsonUpdate))
+	}
+
+	// Version, keyframe, then the client's ID written out in full
+	in := bytes.NewReader(binaryUpdate)
+	version, _ := binary.ReadUvarint(in)
+	kind, _ := binary.ReadUvarint(in)
+	idRef, _ := binary.ReadUvarint(in)
+	idLen, _ := binary.ReadUvarint(in)
+	id := make([]byte, idLen)
+	in.Read(id)
+	if version != ProtocolVersion || kind != keyframeUpdate || idRef != 0 || string(id) != string(playerID) {
+		t.Errorf("Binary update has the wrong header. Version: %d, Kind: %d, ID: %s", version, kind, id)
+	}
+}
+
+func TestNegotiateProtocol(t *testing.T) {
+	// Left running, as updates only go out while the client is listening
+	e := engine.NewEngine(20, 10, engine.WithTickRate(100))
+	e.Start(context.Background())
+	defer e.Stop()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeWs(e, w, r)
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	for _, protocol := range []string{BinaryProtocol, JSONProtocol, ""} {
+		dialer := websocket.Dialer{}
+		if protocol != "" {
+			dialer.Subprotocols = []string{protocol}
+		}
+		conn, _, err := dialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("Failed to connect, err: %v", err)
+		}
+		if conn.Subprotocol() != protocol {
+			t.Errorf("Server picked the wrong protocol. A: %q, E: %q", conn.Subprotocol(), protocol)
+		}
+		conn.WriteJSON(&Handshake{Version: ProtocolVersion})
+		welcome := &Welcome{}
+		if err := conn.ReadJSON(welcome); err != nil {
+			t.Fatalf("Didn't get a welcome, err: %v", err)
+		}
+
+		messageType, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Didn't get an update, err: %v", err)
+		}
+		if protocol == BinaryProtocol {
+			if messageType != websocket.BinaryMessage {
+				t.Errorf("Binary client got a text message")
+			}
+		} else if messageType != websocket.TextMessage || !json.Valid(data) {
+			t.Errorf("%q client didn't get JSON", protocol)
+		}
+		conn.Close()
+	}
+}
@@ -0,0 +1,167 @@
+package client
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/VivaLaPanda/antipath/entity"
+	"github.com/VivaLaPanda/antipath/state"
+	"github.com/VivaLaPanda/antipath/state/tile"
+)
+
+// How many unacknowledged frames we remember per client. If a client's acks
+// fall further behind than this it gets a keyframe instead of a delta.
+const frameHistory = 64
+
+// What a client was sent for one tick, flattened into world coordinates so
+// frames with different roots can be compared
+type frame struct {
+	tick     uint64
+	tiles    map[state.Coordinates]tile.Tile
+	entities map[entity.ID]state.Coordinates
+}
+
+// Delta is an update sent as the changes from a frame the client has already
+// acknowledged. Positions are in world coordinates. Anything outside the new
+// window is no longer visible.
+type Delta struct {
+	Tick uint64
+	// The tick the changes are from
+	Base uint64
+	// The window the client can now see
+	Root   state.Coordinates
+	Width  int
+	Height int
+	// Tiles that changed or came into view
+	Tiles []TileChange
+	// Entities that moved or came into view
+	Entities map[entity.ID]state.Coordinates `json:",omitempty"`
+	// Entities that aren't visible any more
+	Removed []entity.ID `json:",omitempty"`
+}
+
+type TileChange struct {
+	Pos  state.Coordinates
+	Tile *tile.Tile
+}
+
+// Tracks what one client has been sent and acknowledged, and turns each new
+// state into either a keyframe or a delta from the last acknowledged frame
+type deltaEncoder struct {
+	lock sync.Mutex
+	// Frames sent but not acknowledged yet, by tick
+	sent  map[uint64]*frame
+	acked *frame
+}
+
+func newDeltaEncoder() *deltaEncoder {
+	return &deltaEncoder{sent: make(map[uint64]*frame)}
+}
+
+// Records that the client has the frame for `tick`. Acks for frames we've
+// forgotten about, or that are older than the last ack, are ignored.
+func (d *deltaEncoder) Ack(tick uint64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	acked, exists := d.sent[tick]
+	if !exists {
+		return
+	}
+	d.acked = acked
+	for sentTick := range d.sent {
+		if sentTick <= tick {
+			delete(d.sent, sentTick)
+		}
+	}
+}
+
+// Forgets everything the client has acknowledged, so the next update is a
+// keyframe. For when the client has lost track of the world.
+func (d *deltaEncoder) Reset() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.acked = nil
+	d.sent = make(map[uint64]*frame)
+}
+
+// Works out what to send for `s`. Returns nil if the whole state should go as
+// a keyframe.
+func (d *deltaEncoder) Encode(s *state.State) *Delta {
+	current := flatten(s)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.sent[current.tick] = current
+	if len(d.sent) > frameHistory {
+		// The client has stopped acking, start again from a keyframe
+		d.acked = nil
+		d.sent = map[uint64]*frame{current.tick: current}
+	}
+	if d.acked == nil {
+		return nil
+	}
+
+	return diff(d.acked, current, s)
+}
+
+// The tiles are kept by value. The state is a copy nobody changes, so the
+// entities on them can be shared rather than copied again.
+func flatten(s *state.State) *frame {
+	flat := &frame{
+		tick:     s.Tick(),
+		tiles:    make(map[state.Coordinates]tile.Tile),
+		entities: s.Entities(),
+	}
+
+	s.EachTile(func(pos state.Coordinates, t *tile.Tile) {
+		flat.tiles[pos] = *t
+	})
+
+	return flat
+}
+
+func diff(base *frame, current *frame, s *state.State) *Delta {
+	delta := &Delta{
+		Tick:     current.tick,
+		Base:     base.tick,
+		Root:     s.Root(),
+		Tiles:    []TileChange{},
+		Entities: make(map[entity.ID]state.Coordinates),
+	}
+
+	// Walk the tiles in reading order so the output is stable
+	s.EachTile(func(pos state.Coordinates, t *tile.Tile) {
+		delta.Width = pos.X - delta.Root.X + 1
+		delta.Height = pos.Y - delta.Root.Y + 1
+		if old, seen := base.tiles[pos]; !seen || !old.Equal(t) {
+			delta.Tiles = append(delta.Tiles, TileChange{Pos: pos, Tile: t})
+		}
+	})
+
+	for id, pos := range current.entities {
+		if oldPos, existed := base.entities[id]; !existed || oldPos != pos {
+			delta.Entities[id] = pos
+		}
+	}
+	for id := range base.entities {
+		if _, exists := current.entities[id]; !exists {
+			delta.Removed = append(delta.Removed, id)
+		}
+	}
+	sort.Slice(delta.Removed, func(i, j int) bool { return delta.Removed[i] < delta.Removed[j] })
+
+	return delta
+}
+
+func sortedEntityIDs(entities map[entity.ID]state.Coordinates) []entity.ID {
+	ids := make([]entity.ID, 0, len(entities))
+	for id := range entities {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids
+}
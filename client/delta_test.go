@@ -0,0 +1,76 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/VivaLaPanda/antipath/entity/player"
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+func TestDeltaEncoder(t *testing.T) {
+	world := state.NewState(20)
+	playerID, _ := world.NewEntity(player.NewPlayer(), state.Coordinates{X: 10, Y: 10})
+	deltas := newDeltaEncoder()
+
+	// Nothing acked yet, so the first update is a keyframe
+	idlerPos := state.Coordinates{X: 12, Y: 9}
+	world.NewEntity(player.NewPlayer(), idlerPos)
+	delta := deltas.Encode(world.PeekState(playerID, 6))
+	if delta != nil {
+		t.Fatalf("First update wasn't a keyframe. Delta: %v", delta)
+	}
+	deltas.Ack(world.Tick())
+
+	// Change one tile and move the player
+	world.AdvanceTick()
+	hill, _ := world.GetTile(state.Coordinates{X: 9, Y: 9})
+	hill.SetHeight(3)
+	world.ChangePos(playerID, state.Coordinates{X: 11, Y: 10}, 1)
+
+	delta = deltas.Encode(world.PeekState(playerID, 6))
+	if delta == nil {
+		t.Fatalf("Update after an ack wasn't a delta")
+	}
+	if delta.Base != 0 || delta.Tick != 1 {
+		t.Errorf("Delta is from the wrong ticks. Base: %d, Tick: %d", delta.Base, delta.Tick)
+	}
+	// The hill, the tiles the player left and entered, plus a column that
+	// scrolled into view
+	changed := make(map[state.Coordinates]bool)
+	for _, change := range delta.Tiles {
+		changed[change.Pos] = true
+	}
+	for _, pos := range []state.Coordinates{{X: 9, Y: 9}, {X: 10, Y: 10}, {X: 11, Y: 10}, {X: 13, Y: 7}} {
+		if !changed[pos] {
+			t.Errorf("Delta is missing the tile at %v", pos)
+		}
+	}
+	if changed[state.Coordinates{X: 12, Y: 12}] {
+		t.Errorf("Delta has a tile that didn't change")
+	}
+	// Each update has its own copy of whoever's standing still, but they
+	// haven't changed
+	if changed[idlerPos] {
+		t.Errorf("Delta has the tile of a player who didn't move")
+	}
+	if delta.Entities[playerID] != (state.Coordinates{X: 11, Y: 10}) {
+		t.Errorf("Delta didn't move the player. A: %v", delta.Entities)
+	}
+
+	// A client that stops acking eventually gets a keyframe again
+	for idx := 0; idx < frameHistory; idx++ {
+		world.AdvanceTick()
+		delta = deltas.Encode(world.PeekState(playerID, 6))
+	}
+	if delta != nil {
+		t.Errorf("Client that stopped acking didn't get a keyframe")
+	}
+
+	// As does one that asks for it
+	deltas.Ack(world.Tick())
+	deltas.Reset()
+	world.AdvanceTick()
+	if delta = deltas.Encode(world.PeekState(playerID, 6)); delta != nil {
+		t.Errorf("Resyncing client didn't get a keyframe")
+	}
+}
@@ -0,0 +1,190 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/VivaLaPanda/antipath/entity"
+	"github.com/gorilla/websocket"
+)
+
+// The protocol version this server speaks, and the oldest one it still
+// understands. Version 2 added input sequence numbers
+const (
+	ProtocolVersion    = 2
+	MinProtocolVersion = 1
+)
+
+// How long a client gets to send its handshake after connecting
+const handshakeWait = 10 * time.Second
+
+const maxNameLength = 32
+
+// Encodings a client can ask for in its handshake
+const (
+	JSONEncoding   = "json"
+	BinaryEncoding = "binary"
+)
+
+// Capabilities a client can declare. Anything we don't recognise is ignored.
+const (
+	// The client acks updates and can apply deltas from them
+	DeltaCapability = "delta"
+)
+
+var knownCapabilities = map[string]bool{
+	DeltaCapability: true,
+}
+
+// Close codes sent when a handshake is rejected. The close reason is a
+// Rejection encoded as JSON.
+const (
+	CloseBadHandshake        = 4000
+	CloseUnsupportedVersion  = 4001
+	CloseUnsupportedEncoding = 4002
+	CloseBadName             = 4003
+	// Not a handshake rejection. Sent when another connection presents the
+	// same session and takes the player over
+	CloseReplaced = 4004
+	// Sent when the client hasn't kept up with its updates for too long.
+	// Its session can still be resumed
+	CloseTooSlow = 4005
+)
+
+// Handshake is the first message a client sends, always as JSON
+type Handshake struct {
+	Version int
+	// "json" or "binary". Empty goes with whatever subprotocol was agreed
+	Encoding     string
+	Name         string
+	Capabilities []string
+	// The token from an earlier Welcome, to carry on as the same player
+	Session string
+}
+
+// Welcome is the server's answer to an accepted handshake, sent as JSON.
+// Updates follow in the agreed encoding.
+type Welcome struct {
+	Version  int
+	Encoding string
+	ClientID entity.ID
+	// The capabilities the server agreed to
+	Capabilities []string
+	WindowSize   int
+	// Present this in a later handshake to come back as the same player
+	Session string
+	// Whether this connection picked up an existing player
+	Resumed bool
+}
+
+// Rejection explains why a handshake was refused
+type Rejection struct {
+	Reason     string `json:"reason"`
+	MinVersion int    `json:"minVersion,omitempty"`
+	MaxVersion int    `json:"maxVersion,omitempty"`
+}
+
+type handshakeError struct {
+	code      int
+	rejection Rejection
+}
+
+func (err *handshakeError) Error() string {
+	return fmt.Sprintf("handshake rejected (%d): %s", err.code, err.rejection.Reason)
+}
+
+// Waits for the client's handshake and checks we can talk to it
+func readHandshake(conn *websocket.Conn) (*Handshake, error) {
+	// Nobody's checked who this is yet, so don't let them send us much or
+	// take long about it
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(handshakeWait))
+	defer conn.SetReadDeadline(time.Time{})
+
+	messageType, data, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	if messageType != websocket.TextMessage {
+		return nil, &handshakeError{CloseBadHandshake, Rejection{Reason: "handshake must be JSON"}}
+	}
+
+	handshake := &Handshake{}
+	if err := json.Unmarshal(data, handshake); err != nil {
+		return nil, &handshakeError{CloseBadHandshake, Rejection{Reason: "handshake isn't valid JSON"}}
+	}
+	if err := handshake.validate(conn.Subprotocol()); err != nil {
+		return nil, err
+	}
+
+	return handshake, nil
+}
+
+// Checks the handshake, filling in the encoding if the client left it to the
+// subprotocol
+func (handshake *Handshake) validate(subprotocol string) error {
+	if handshake.Version < MinProtocolVersion || handshake.Version > ProtocolVersion {
+		return &handshakeError{CloseUnsupportedVersion, Rejection{
+			Reason:     "unsupported protocol version",
+			MinVersion: MinProtocolVersion,
+			MaxVersion: ProtocolVersion,
+		}}
+	}
+
+	switch handshake.Encoding {
+	case "":
+		handshake.Encoding = JSONEncoding
+		if subprotocol == BinaryProtocol {
+			handshake.Encoding = BinaryEncoding
+		}
+	case JSONEncoding, BinaryEncoding:
+	default:
+		return &handshakeError{CloseUnsupportedEncoding, Rejection{Reason: "unsupported encoding"}}
+	}
+
+	handshake.Name = strings.TrimSpace(handshake.Name)
+	if len(handshake.Name) > maxNameLength {
+		return &handshakeError{CloseBadName, Rejection{Reason: "name is too long"}}
+	}
+	for _, char := range handshake.Name {
+		if !unicode.IsPrint(char) {
+			return &handshakeError{CloseBadName, Rejection{Reason: "name has unprintable characters"}}
+		}
+	}
+
+	accepted := []string{}
+	for _, capability := range handshake.Capabilities {
+		if knownCapabilities[capability] {
+			accepted = append(accepted, capability)
+		}
+	}
+	handshake.Capabilities = accepted
+
+	return nil
+}
+
+func (handshake *Handshake) has(capability string) bool {
+	for _, accepted := range handshake.Capabilities {
+		if accepted == capability {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Hangs up on a client whose handshake we didn't like, telling it why
+func reject(conn *websocket.Conn, err error) {
+	code, rejection := CloseBadHandshake, Rejection{Reason: "no handshake"}
+	if rejected, ok := err.(*handshakeError); ok {
+		code, rejection = rejected.code, rejected.rejection
+	}
+
+	reason, _ := json.Marshal(rejection)
+	conn.SetWriteDeadline(time.Now().Add(writeWait))
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, string(reason)))
+	conn.Close()
+}
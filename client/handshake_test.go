@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/VivaLaPanda/antipath/engine"
+	"github.com/gorilla/websocket"
+)
+
+// Starts a server for `e` and returns the websocket URL to reach it on
+func testServer(t *testing.T, e *engine.Engine) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeWs(e, w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestHandshake(t *testing.T) {
+	e := engine.NewEngine(20, 10, engine.WithTickRate(100))
+	e.Start(context.Background())
+	defer e.Stop()
+	url := testServer(t, e)
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect, err: %v", err)
+	}
+	defer conn.Close()
+	conn.WriteJSON(&Handshake{
+		Version:      ProtocolVersion,
+		Encoding:     BinaryEncoding,
+		Name:         "  alice ",
+		Capabilities: []string{DeltaCapability, "telepathy"},
+	})
+
+	welcome := &Welcome{}
+	if err := conn.ReadJSON(welcome); err != nil {
+		t.Fatalf("Didn't get a welcome, err: %v", err)
+	}
+	if welcome.Encoding != BinaryEncoding || len(welcome.Capabilities) != 1 || welcome.Capabilities[0] != DeltaCapability {
+		t.Errorf("Welcome didn't agree to the right things. A: %+v", welcome)
+	}
+	if e.GetPlayer(welcome.ClientID).Name != "alice" {
+		t.Errorf("Player didn't get their name. A: %q, E: %q", e.GetPlayer(welcome.ClientID).Name, "alice")
+	}
+
+	// Updates come in the encoding we asked for, not the subprotocol's
+	messageType, _, err := conn.ReadMessage()
+	if err != nil || messageType != websocket.BinaryMessage {
+		t.Errorf("Update didn't come in the agreed encoding. Type: %d, Err: %v", messageType, err)
+	}
+}
+
+func TestHandshakeRejected(t *testing.T) {
+	e := engine.NewEngine(20, 10, engine.WithManualTicks())
+	url := testServer(t, e)
+
+	cases := []struct {
+		handshake interface{}
+		code      int
+	}{
+		{&Handshake{Version: ProtocolVersion + 1}, CloseUnsupportedVersion},
+		{&Handshake{Version: ProtocolVersion, Encoding: "xml"}, CloseUnsupportedEncoding},
+		{&Handshake{Version: ProtocolVersion, Name: "tab\there"}, CloseBadName},
+		{"not a handshake", CloseBadHandshake},
+	}
+	for _, testCase := range cases {
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatalf("Failed to connect, err: %v", err)
+		}
+		conn.WriteJSON(testCase.handshake)
+
+		_, _, err = conn.ReadMessage()
+		closeErr, ok := err.(*websocket.CloseError)
+		if !ok || closeErr.Code != testCase.code {
+			t.Errorf("Bad handshake wasn't rejected properly. A: %v, E: %d", err, testCase.code)
+			conn.Close()
+			continue
+		}
+		rejection := &Rejection{}
+		if err := json.Unmarshal([]byte(closeErr.Text), rejection); err != nil || rejection.Reason == "" {
+			t.Errorf("Close reason isn't a rejection. A: %q", closeErr.Text)
+		}
+		conn.Close()
+	}
+
+	if len(e.Snapshot().Players) != 0 {
+		t.Errorf("Rejected clients were added to the game. A: %d", len(e.Snapshot().Players))
+	}
+}
+
+func TestHandshakeTooBig(t *testing.T) {
+	e := engine.NewEngine(20, 10, engine.WithManualTicks())
+	url := testServer(t, e)
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect, err: %v", err)
+	}
+	defer conn.Close()
+	conn.WriteJSON(&Handshake{Version: ProtocolVersion, Name: strings.Repeat("a", 64*1024)})
+
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+		t.Errorf("Huge handshake wasn't turned away. A: %v, E: %d", err, websocket.CloseMessageTooBig)
+	}
+	if len(e.Snapshot().Players) != 0 {
+		t.Errorf("Huge handshake was let in. A: %d", len(e.Snapshot().Players))
+	}
+}
@@ -0,0 +1,156 @@
+package client
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/VivaLaPanda/antipath/client/auth"
+	"github.com/VivaLaPanda/antipath/engine"
+	"github.com/gorilla/websocket"
+)
+
+// Server lets clients into a game, checking where they've come from and who
+// they are before they get a player
+type Server struct {
+	engine *engine.Engine
+	// Nil lets anyone in
+	authenticator auth.Authenticator
+	profiles      *auth.Profiles
+	origins       []string
+	upgrader      websocket.Upgrader
+}
+
+type ServerOption func(*Server)
+
+// Only lets in clients `authenticator` recognises. Each identity gets a
+// profile, so they come back as the same player whichever device they
+// connect from.
+func WithAuthenticator(authenticator auth.Authenticator) ServerOption {
+	return func(s *Server) {
+		s.authenticator = authenticator
+	}
+}
+
+// Where signed in players' profiles are kept. Without it they're kept in
+// memory and forgotten when the server stops.
+func WithProfiles(profiles *auth.Profiles) ServerOption {
+	return func(s *Server) {
+		s.profiles = profiles
+	}
+}
+
+// Lets browsers connect from pages on these origins, e.g.
+// "https://example.com". A bare host matches it on any scheme, and "*"
+// matches anything. By default only pages from our own host can connect.
+// Clients that aren't browsers don't send an origin and are always allowed.
+func WithOrigins(origins ...string) ServerOption {
+	return func(s *Server) {
+		s.origins = origins
+	}
+}
+
+func NewServer(e *engine.Engine, options ...ServerOption) *Server {
+	server := &Server{engine: e}
+	for _, option := range options {
+		option(server)
+	}
+	if server.authenticator != nil && server.profiles == nil {
+		server.profiles, _ = auth.OpenProfiles("")
+	}
+
+	server.upgrader = websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		// In order of preference
+		Subprotocols: []string{BinaryProtocol, JSONProtocol},
+		CheckOrigin:  server.checkOrigin,
+	}
+
+	return server
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	log.Println("Client attempting to connect...")
+	// Both of these are checked before upgrading so the client gets a
+	// proper HTTP status back
+	if !s.checkOrigin(r) {
+		log.Printf("Turning client away, origin %q isn't allowed", r.Header.Get("Origin"))
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	var profile *auth.Profile
+	if s.authenticator != nil {
+		identity, err := s.authenticator.Authenticate(r)
+		if err != nil {
+			log.Printf("Turning client away, couldn't authenticate: %v", err)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			if errors.Is(err, auth.ErrNoCredentials) {
+				http.Error(w, "sign in to play", http.StatusUnauthorized)
+			} else {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+			}
+			return
+		}
+		found := s.profiles.Get(identity)
+		profile = &found
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	handshake, err := readHandshake(conn)
+	if err != nil {
+		log.Printf("Turning client away: %v", err)
+		reject(conn, err)
+		return
+	}
+	if profile != nil && profile.Name != "" {
+		// Signed in players go by the name they signed in with
+		handshake.Name = profile.Name
+	}
+	// Make the client
+	client, err := newClient(conn, s.engine, handshake, profile)
+	if err != nil {
+		log.Printf("Couldn't welcome client: %v", err)
+		conn.Close()
+		return
+	}
+	if profile != nil {
+		if err := s.profiles.Played(profile.Subject, client.playerID, handshake.Name); err != nil {
+			log.Printf("Failed to save profile for %s: %v", profile.Subject, err)
+		}
+	}
+	// Allow collection of memory referenced by the caller by doing all work in
+	// new goroutines.
+	connections.Add(1)
+	go client.writePump()
+	go client.readPump()
+	log.Printf("Client connected and in game. ID: %v", client.playerID)
+}
+
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if len(s.origins) == 0 {
+		return strings.EqualFold(originURL.Host, r.Host)
+	}
+
+	for _, allowed := range s.origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) || strings.EqualFold(allowed, originURL.Host) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VivaLaPanda/antipath/client/auth"
+	"github.com/VivaLaPanda/antipath/engine"
+	"github.com/gorilla/websocket"
+)
+
+func testServerWith(t *testing.T, e *engine.Engine, options ...ServerOption) string {
+	server := httptest.NewServer(NewServer(e, options...))
+	t.Cleanup(server.Close)
+
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestOrigins(t *testing.T) {
+	e := engine.NewEngine(20, 10, engine.WithManualTicks())
+
+	cases := []struct {
+		allowed []string
+		origin  string
+		ok      bool
+	}{
+		{nil, "", true},
+		{nil, "http://evil.example", false},
+		{[]string{"https://good.example"}, "https://good.example", true},
+		{[]string{"https://good.example"}, "http://good.example", false},
+		{[]string{"good.example"}, "http://good.example", true},
+		{[]string{"*"}, "http://evil.example", true},
+	}
+	for _, testCase := range cases {
+		url := testServerWith(t, e, WithOrigins(testCase.allowed...))
+		header := http.Header{}
+		if testCase.origin != "" {
+			header.Set("Origin", testCase.origin)
+		}
+
+		conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+		if testCase.ok && err != nil {
+			t.Errorf("Allowed origin was turned away. Allowed: %v, Origin: %q, Err: %v", testCase.allowed, testCase.origin, err)
+		}
+		if !testCase.ok && (err == nil || resp.StatusCode != http.StatusForbidden) {
+			t.Errorf("Origin wasn't turned away. Allowed: %v, Origin: %q", testCase.allowed, testCase.origin)
+		}
+		if conn != nil {
+			conn.Close()
+		}
+	}
+}
+
+func TestAuthenticatedServer(t *testing.T) {
+	e := engine.NewEngine(20, 10, engine.WithTickRate(100), engine.WithDisconnectGrace(time.Minute))
+	e.Start(context.Background())
+	defer e.Stop()
+	tokens, err := auth.ReadTokenFile(strings.NewReader("secret-token alice Alice\n"))
+	if err != nil {
+		t.Fatalf("Failed to read tokens, err: %v", err)
+	}
+	url := testServerWith(t, e, WithAuthenticator(tokens))
+
+	// Nobody gets in without a token
+	for _, query := range []string{"", "?token=guess"} {
+		_, resp, err := websocket.DefaultDialer.Dial(url+query, nil)
+		if err == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Client without a good token was let in. Query: %q", query)
+		}
+	}
+
+	header := http.Header{"Authorization": []string{"Bearer secret-token"}}
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("Failed to connect, err: %v", err)
+	}
+	conn.WriteJSON(&Handshake{Version: ProtocolVersion, Name: "not alice"})
+	first := &Welcome{}
+	if err := conn.ReadJSON(first); err != nil {
+		t.Fatalf("Didn't get a welcome, err: %v", err)
+	}
+	if e.GetPlayer(first.ClientID).Name != "Alice" {
+		t.Errorf("Player didn't get their profile's name. A: %q, E: %q", e.GetPlayer(first.ClientID).Name, "Alice")
+	}
+	conn.Close()
+
+	// Signing in again finds their player without a session token
+	conn, _, err = websocket.DefaultDialer.Dial(url+"?token=secret-token", nil)
+	if err != nil {
+		t.Fatalf("Failed to reconnect, err: %v", err)
+	}
+	defer conn.Close()
+	conn.WriteJSON(&Handshake{Version: ProtocolVersion})
+	second := &Welcome{}
+	if err := conn.ReadJSON(second); err != nil {
+		t.Fatalf("Didn't get a welcome, err: %v", err)
+	}
+	if !second.Resumed || second.ClientID != first.ClientID {
+		t.Errorf("Didn't get their player back. A: %v, E: %v", second.ClientID, first.ClientID)
+	}
+}
+
+func TestProfileOnlyResumesOwnPlayer(t *testing.T) {
+	e := engine.NewEngine(20, 10, engine.WithTickRate(100), engine.WithDisconnectGrace(time.Minute))
+	e.Start(context.Background())
+	defer e.Stop()
+	tokens, err := auth.ReadTokenFile(strings.NewReader("secret-token alice Alice\n"))
+	if err != nil {
+		t.Fatalf("Failed to read tokens, err: %v", err)
+	}
+	profiles, err := auth.OpenProfiles(filepath.Join(t.TempDir(), "profiles.json"))
+	if err != nil {
+		t.Fatalf("Failed to open profiles, err: %v", err)
+	}
+	url := testServerWith(t, e, WithAuthenticator(tokens), WithProfiles(profiles))
+
+	// Like a world started over from the same seed, someone else now has the
+	// ID alice played as last time
+	strangerID, _ := e.AddPlayer()
+	profiles.Played("alice", strangerID, "Alice")
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?token=secret-token", nil)
+	if err != nil {
+		t.Fatalf("Failed to connect, err: %v", err)
+	}
+	defer conn.Close()
+	conn.WriteJSON(&Handshake{Version: ProtocolVersion})
+	welcome := &Welcome{}
+	if err := conn.ReadJSON(welcome); err != nil {
+		t.Fatalf("Didn't get a welcome, err: %v", err)
+	}
+	if welcome.Resumed || welcome.ClientID == strangerID {
+		t.Errorf("Signed in player took over someone else's player. A: %+v", welcome)
+	}
+	if e.Owner(welcome.ClientID) != "alice" {
+		t.Errorf("New player wasn't marked as theirs. A: %q, E: %q", e.Owner(welcome.ClientID), "alice")
+	}
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+
+	"github.com/VivaLaPanda/antipath/engine"
+	"github.com/VivaLaPanda/antipath/entity"
+)
+
+// Session tokens are this many random bytes, hex encoded
+const sessionTokenBytes = 32
+
+// Sessions tie the tokens handed out on join to the players they were issued
+// for, so a client that drops can come back as the same player. They also
+// keep track of which connection is playing as each player, so only one is.
+// Each engine has its own, since player IDs only mean something to the engine
+// that handed them out. Each player has at most one token, which is thrown
+// away once the engine removes them.
+type sessionStore struct {
+	lock   sync.Mutex
+	tokens map[string]entity.ID
+	// The token each player was last issued
+	playerTokens map[entity.ID]string
+	clients      map[entity.ID]*Client
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{
+		tokens:       make(map[string]entity.ID),
+		playerTokens: make(map[entity.ID]string),
+		clients:      make(map[entity.ID]*Client),
+	}
+}
+
+// Every running engine's sessions. They're shared by every Server for the
+// engine, so ServeWs, which makes a Server per connection, still works
+var sessionStores = struct {
+	lock   sync.Mutex
+	stores map[*engine.Engine]*sessionStore
+}{stores: make(map[*engine.Engine]*sessionStore)}
+
+// The sessions for players in `e`. They're thrown away once it stops
+func sessionsFor(e *engine.Engine) *sessionStore {
+	sessionStores.lock.Lock()
+	store, exists := sessionStores.stores[e]
+	if !exists {
+		store = newSessionStore()
+		sessionStores.stores[e] = store
+	}
+	sessionStores.lock.Unlock()
+
+	if !exists {
+		e.OnRemove(store.forgetPlayer)
+		e.OnStop(func() {
+			sessionStores.lock.Lock()
+			defer sessionStores.lock.Unlock()
+
+			delete(sessionStores.stores, e)
+		})
+	}
+
+	return store
+}
+
+// Hands out a new token for `playerID`, replacing any they had before
+func (store *sessionStore) issue(playerID entity.ID) (string, error) {
+	raw := make([]byte, sessionTokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(raw)
+
+	store.lock.Lock()
+	delete(store.tokens, store.playerTokens[playerID])
+	store.tokens[token] = playerID
+	store.playerTokens[playerID] = token
+	store.lock.Unlock()
+
+	return token, nil
+}
+
+// Looks up the player a token was issued for
+func (store *sessionStore) lookup(token string) (entity.ID, bool) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	playerID, exists := store.tokens[token]
+	return playerID, exists
+}
+
+// Throws away a token whose player is gone
+func (store *sessionStore) forget(token string) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if playerID, exists := store.tokens[token]; exists && store.playerTokens[playerID] == token {
+		delete(store.playerTokens, playerID)
+	}
+	delete(store.tokens, token)
+}
+
+// Throws away the token of a player who's gone
+func (store *sessionStore) forgetPlayer(playerID entity.ID) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if token, exists := store.playerTokens[playerID]; exists {
+		delete(store.tokens, token)
+		delete(store.playerTokens, playerID)
+	}
+}
+
+// Makes `client` the connection playing as `playerID`. Any connection that
+// was playing as them before is told it's been replaced.
+func (store *sessionStore) bind(playerID entity.ID, client *Client) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if existing, exists := store.clients[playerID]; exists && existing != client {
+		existing.replaced.Store(true)
+	}
+	store.clients[playerID] = client
+}
+
+// Lets go of `playerID` if `client` is still the one playing as them
+func (store *sessionStore) release(playerID entity.ID, client *Client) {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	if store.clients[playerID] == client {
+		delete(store.clients, playerID)
+	}
+}
@@ -0,0 +1,177 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/VivaLaPanda/antipath/engine"
+	"github.com/gorilla/websocket"
+)
+
+// Connects to `url` and handshakes, presenting `session` if it isn't empty
+func join(t *testing.T, url string, session string) (*websocket.Conn, *Welcome) {
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect, err: %v", err)
+	}
+	conn.WriteJSON(&Handshake{Version: ProtocolVersion, Session: session})
+
+	welcome := &Welcome{}
+	if err := conn.ReadJSON(welcome); err != nil {
+		t.Fatalf("Didn't get a welcome, err: %v", err)
+	}
+
+	return conn, welcome
+}
+
+func TestResumeSession(t *testing.T) {
+	e := engine.NewEngine(20, 10, engine.WithTickRate(100), engine.WithDisconnectGrace(time.Minute))
+	e.Start(context.Background())
+	defer e.Stop()
+	url := testServer(t, e)
+
+	conn, first := join(t, url, "")
+	if first.Session == "" || first.Resumed {
+		t.Fatalf("New player didn't get a fresh session. A: %+v", first)
+	}
+	conn.Close()
+
+	conn, second := join(t, url, first.Session)
+	defer conn.Close()
+	if !second.Resumed || second.ClientID != first.ClientID {
+		t.Errorf("Didn't come back as the same player. A: %v, E: %v", second.ClientID, first.ClientID)
+	}
+	if second.Session != first.Session {
+		t.Errorf("Resuming changed the session. A: %q, E: %q", second.Session, first.Session)
+	}
+	if len(e.Snapshot().Players) != 1 {
+		t.Errorf("Resuming added another player. A: %d, E: 1", len(e.Snapshot().Players))
+	}
+}
+
+func TestSessionTakeover(t *testing.T) {
+	e := engine.NewEngine(20, 10, engine.WithTickRate(100), engine.WithDisconnectGrace(time.Minute))
+	e.Start(context.Background())
+	defer e.Stop()
+	url := testServer(t, e)
+
+	oldConn, first := join(t, url, "")
+	defer oldConn.Close()
+	newConn, second := join(t, url, first.Session)
+	defer newConn.Close()
+	if !second.Resumed || second.ClientID != first.ClientID {
+		t.Errorf("Didn't take over the player. A: %v, E: %v", second.ClientID, first.ClientID)
+	}
+
+	// The old connection gets its updates cut off and is told why
+	oldConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := oldConn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, CloseReplaced) {
+			t.Errorf("Old connection wasn't closed as replaced. A: %v, E: %d", err, CloseReplaced)
+		}
+		break
+	}
+
+	// And hanging up doesn't take the player with it
+	oldConn.Close()
+	time.Sleep(50 * time.Millisecond)
+	if e.GetPlayer(first.ClientID) == nil {
+		t.Errorf("Old connection closing removed the player")
+	}
+}
+
+func TestExpiredSession(t *testing.T) {
+	e := engine.NewEngine(20, 10, engine.WithTickRate(100), engine.WithDisconnectGrace(50*time.Millisecond))
+	e.Start(context.Background())
+	defer e.Stop()
+	url := testServer(t, e)
+
+	conn, first := join(t, url, "")
+	conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for e.GetPlayer(first.ClientID) != nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	conn, second := join(t, url, first.Session)
+	defer conn.Close()
+	if second.Resumed || second.ClientID == first.ClientID {
+		t.Errorf("Expired session picked the player back up. A: %+v", second)
+	}
+	if second.Session == first.Session {
+		t.Errorf("Expired session wasn't replaced with a new one")
+	}
+
+	conn, third := join(t, url, "made up")
+	defer conn.Close()
+	if third.Resumed {
+		t.Errorf("Unknown session resumed someone. A: %+v", third)
+	}
+}
+
+func TestSessionsForgotten(t *testing.T) {
+	e := engine.NewEngine(20, 10, engine.WithTickRate(100))
+	e.Start(context.Background())
+	defer e.Stop()
+	url := testServer(t, e)
+
+	conn, welcome := join(t, url, "")
+	sessions := sessionsFor(e)
+	if _, known := sessions.lookup(welcome.Session); !known {
+		t.Fatalf("Session wasn't issued")
+	}
+
+	// With no grace period the player goes as soon as they hang up, and their
+	// session with them
+	conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for e.GetPlayer(welcome.ClientID) != nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, known := sessions.lookup(welcome.Session); known {
+		t.Errorf("Removed player's session was kept")
+	}
+
+	// Players only ever have their latest token
+	first, _ := sessions.issue("reissued")
+	second, _ := sessions.issue("reissued")
+	if _, known := sessions.lookup(first); known {
+		t.Errorf("Reissuing kept the old token")
+	}
+	sessions.forgetPlayer("reissued")
+	if _, known := sessions.lookup(second); known {
+		t.Errorf("Forgetting the player kept their token")
+	}
+}
+
+func TestSessionsPerEngine(t *testing.T) {
+	// Same seed, so both hand out the same IDs
+	first := engine.NewEngine(20, 10, engine.WithTickRate(100), engine.WithSeed(1), engine.WithDisconnectGrace(time.Minute))
+	first.Start(context.Background())
+	defer first.Stop()
+	second := engine.NewEngine(20, 10, engine.WithTickRate(100), engine.WithSeed(1), engine.WithDisconnectGrace(time.Minute))
+	second.Start(context.Background())
+	defer second.Stop()
+
+	firstConn, firstWelcome := join(t, testServer(t, first), "")
+	defer firstConn.Close()
+	secondConn, secondWelcome := join(t, testServer(t, second), firstWelcome.Session)
+	defer secondConn.Close()
+	if secondWelcome.Resumed {
+		t.Errorf("Session from one engine resumed a player in another. A: %+v", secondWelcome)
+	}
+
+	// An engine's sessions go once it stops
+	second.Stop()
+	sessionStores.lock.Lock()
+	_, kept := sessionStores.stores[second]
+	sessionStores.lock.Unlock()
+	if kept {
+		t.Errorf("Stopped engine's sessions were kept")
+	}
+}
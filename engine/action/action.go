@@ -2,9 +2,30 @@ package action
 
 import "github.com/VivaLaPanda/antipath/state"
 
+// The kinds of attack a Set can ask for
+const (
+	// Don't attack this tick
+	NoAttack = iota
+	// A sweep at foot level. Hits hard but can be jumped over
+	LowAttack = iota
+	// An overhead swing. Weaker, but reaches players in the air
+	HighAttack = iota
+	// Fires a projectile in AttackDir
+	RangedAttack = iota
+)
+
 type Set struct {
+	// The client's number for this input, counting up from 1. Sequenced
+	// inputs are queued and applied in order. Each tick takes as many as it
+	// can off the front of the queue, merged together, until the next would
+	// be a second move or a second attack. 0 leaves it unsequenced,
+	// replacing anything still queued
+	Seq       uint64
 	Movement  state.Coordinates
 	Jump      bool
 	Attack    int
 	AttackDir state.Direction
+	// Places a totem on the tile in AttackDir. Positive for a good totem,
+	// negative for an evil one, 0 to not place one
+	PlaceTotem int
 }
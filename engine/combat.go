@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"github.com/VivaLaPanda/antipath/engine/action"
+	"github.com/VivaLaPanda/antipath/entity"
+	"github.com/VivaLaPanda/antipath/entity/player"
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+// How an attack type behaves. An attack covers altitudes from the attacker's
+// altitude + minReach up to (but not including) altitude + maxReach.
+type attackStats struct {
+	damage   uint
+	minReach int
+	maxReach int
+}
+
+// Gives the stats of a melee attack, and false if the type isn't a melee attack
+func meleeStats(attackType int, attacker *player.Player) (stats attackStats, ok bool) {
+	switch attackType {
+	case action.LowAttack:
+		return attackStats{damage: 20, minReach: 0, maxReach: 1}, true
+	case action.HighAttack:
+		return attackStats{damage: 10, minReach: 1, maxReach: attacker.Height()}, true
+	}
+
+	return attackStats{}, false
+}
+
+// Whether an attack from `altitude` with `stats` reaches any part of `victim`
+func (stats attackStats) reaches(altitude int, victim *player.Player) bool {
+	victimBottom := victim.Altitude
+	victimTop := victim.Altitude + victim.Height()
+
+	return altitude+stats.minReach < victimTop && victimBottom < altitude+stats.maxReach
+}
+
+// Whether `dir` points at one of the four tiles next door. Clients can send
+// any number, and anything else would have them attacking their own tile
+func towardsNeighbour(dir state.Direction) bool {
+	switch dir {
+	case state.Up, state.Right, state.Left, state.Down:
+		return true
+	}
+
+	return false
+}
+
+// Resolves the attacks in this tick's actions. Runs after movement, so attacks
+// land wherever everyone ended up this tick.
+func (e *Engine) processCombat() {
+	for _, attackerID := range sortedIDs(e.actionsToProcess) {
+		playerAction := e.actionsToProcess[attackerID]
+		if !towardsNeighbour(playerAction.AttackDir) {
+			continue
+		}
+		if playerAction.Attack == action.NoAttack && playerAction.PlaceTotem == 0 {
+			continue
+		}
+
+		e.playersLock.RLock()
+		attacker := e.players[attackerID]
+		e.playersLock.RUnlock()
+		pos, exists := e.gameState.GetEntityPos(attackerID)
+		if !exists {
+			continue
+		}
+
+		if playerAction.PlaceTotem != 0 {
+			e.placeTotem(attacker, state.Offset(pos, playerAction.AttackDir, 1), playerAction.PlaceTotem)
+		}
+		if playerAction.Attack == action.RangedAttack {
+			e.launchProjectile(attackerID, pos, playerAction.AttackDir, attacker.Altitude+1)
+			continue
+		}
+		stats, ok := meleeStats(playerAction.Attack, attacker)
+		if !ok {
+			continue
+		}
+
+		// Melee attacks hit whatever is on the adjacent tile, and if there's
+		// nobody there, the totem
+		targetPos := state.Offset(pos, playerAction.AttackDir, 1)
+		targetTile, err := e.gameState.PeekTile(targetPos)
+		if err != nil {
+			continue
+		}
+		if targetTile.PeekEntity() != nil {
+			e.hitPlayer(attackerID, targetTile.PeekEntity().ID(), attacker.Altitude, stats)
+		} else {
+			e.hitTotem(attackerID, targetPos, stats.damage)
+		}
+	}
+}
+
+// Applies an attack to a player if it can reach them. Returns whether it hit.
+func (e *Engine) hitPlayer(attackerID entity.ID, victimID entity.ID, altitude int, stats attackStats) bool {
+	e.playersLock.RLock()
+	victim, isPlayer := e.players[victimID]
+	e.playersLock.RUnlock()
+	if !isPlayer || !stats.reaches(altitude, victim) {
+		return false
+	}
+
+	victim.Damage(stats.damage)
+	if _, alreadyKilled := e.killers[victimID]; victim.Dead() && !alreadyKilled {
+		e.killers[victimID] = attackerID
+	}
+
+	hit := Event{
+		Kind:     Hit,
+		Tick:     e.Tick(),
+		Attacker: attackerID,
+		Victim:   victimID,
+		Damage:   stats.damage,
+	}
+	e.notify(attackerID, hit)
+	e.notify(victimID, hit)
+
+	return true
+}
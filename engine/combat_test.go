@@ -0,0 +1,155 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/VivaLaPanda/antipath/engine/action"
+	"github.com/VivaLaPanda/antipath/entity"
+	"github.com/VivaLaPanda/antipath/entity/player"
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+// Adds a player to the engine at a known position
+func addPlayerAt(t *testing.T, e *Engine, pos state.Coordinates) (entity.ID, *player.Player) {
+	newPlayer := player.NewPlayer()
+	entityID, err := e.gameState.NewEntity(newPlayer, pos)
+	if err != nil {
+		t.Fatalf("Couldn't place player at %v: %v", pos, err)
+	}
+	newPlayer.PlayerID = entityID
+	e.players[entityID] = newPlayer
+
+	return entityID, newPlayer
+}
+
+func TestMeleeAttack(t *testing.T) {
+	engine := NewEngine(20, 10, WithManualTicks())
+	attackerID, _ := addPlayerAt(t, engine, state.Coordinates{X: 5, Y: 5})
+	victimID, victim := addPlayerAt(t, engine, state.Coordinates{X: 6, Y: 5})
+	updates := make(chan *Update, 1)
+	engine.RegisterClient(victimID, updates)
+	attackerUpdates := make(chan *Update, 1)
+	engine.RegisterClient(attackerID, attackerUpdates)
+
+	// Swinging the wrong way hits nothing
+	engine.SetAction(attackerID, action.Set{Movement: state.Coordinates{X: 5, Y: 5}, Attack: action.LowAttack, AttackDir: state.Left})
+	engine.Step(1)
+	if victim.Health != 100 {
+		t.Errorf("Attack in the wrong direction did damage. Health: %d", victim.Health)
+	}
+	<-updates
+	<-attackerUpdates
+
+	engine.SetAction(attackerID, action.Set{Movement: state.Coordinates{X: 5, Y: 5}, Attack: action.LowAttack, AttackDir: state.Right})
+	engine.Step(1)
+	if victim.Health != 80 {
+		t.Errorf("Low attack did the wrong damage. A: %d, E: %d", victim.Health, 80)
+	}
+
+	update := <-updates
+	if len(update.Events) != 1 || update.Events[0].Kind != Hit || update.Events[0].Attacker != attackerID {
+		t.Errorf("Victim wasn't told about the hit. Events: %v", update.Events)
+	}
+	update = <-attackerUpdates
+	if len(update.Events) != 1 || update.Events[0].Victim != victimID || update.Events[0].Damage != 20 {
+		t.Errorf("Attacker wasn't told about the hit. Events: %v", update.Events)
+	}
+}
+
+func TestAttackReach(t *testing.T) {
+	engine := NewEngine(20, 10, WithManualTicks())
+	attackerID, _ := addPlayerAt(t, engine, state.Coordinates{X: 5, Y: 5})
+	victimID, victim := addPlayerAt(t, engine, state.Coordinates{X: 5, Y: 4})
+	stay := state.Coordinates{X: 5, Y: 5}
+
+	// Low attacks go under a jumping player
+	engine.SetAction(victimID, action.Set{Movement: state.Coordinates{X: 5, Y: 4}, Jump: true})
+	engine.SetAction(attackerID, action.Set{Movement: stay, Attack: action.LowAttack, AttackDir: state.Up})
+	engine.Step(1)
+	if victim.Health != 100 {
+		t.Errorf("Low attack hit a jumping player. Health: %d", victim.Health)
+	}
+
+	// High attacks still reach them
+	engine.SetAction(attackerID, action.Set{Movement: stay, Attack: action.HighAttack, AttackDir: state.Up})
+	engine.Step(1)
+	if victim.Health != 90 {
+		t.Errorf("High attack did the wrong damage to a jumping player. A: %d, E: %d", victim.Health, 90)
+	}
+}
+
+func TestRangedAttack(t *testing.T) {
+	engine := NewEngine(20, 10, WithManualTicks())
+	shooterID, _ := addPlayerAt(t, engine, state.Coordinates{X: 5, Y: 10})
+	_, victim := addPlayerAt(t, engine, state.Coordinates{X: 5, Y: 5})
+	stay := state.Coordinates{X: 5, Y: 10}
+
+	engine.SetAction(shooterID, action.Set{Movement: stay, Attack: action.RangedAttack, AttackDir: state.Up})
+	engine.Step(1)
+	if len(engine.projectiles) != 1 {
+		t.Fatalf("Ranged attack didn't launch a projectile")
+	}
+	if victim.Health != 100 {
+		t.Errorf("Projectile hit before it got there. Health: %d", victim.Health)
+	}
+
+	engine.Step(1)
+	if victim.Health != 85 {
+		t.Errorf("Projectile did the wrong damage. A: %d, E: %d", victim.Health, 85)
+	}
+	if len(engine.projectiles) != 0 {
+		t.Errorf("Projectile wasn't removed after hitting a player")
+	}
+}
+
+func TestProjectileExpires(t *testing.T) {
+	engine := NewEngine(50, 10, WithManualTicks())
+	shooterID, _ := addPlayerAt(t, engine, state.Coordinates{X: 0, Y: 25})
+	stay := state.Coordinates{X: 0, Y: 25}
+
+	// Into open space, so it flies until it runs out of range
+	engine.SetAction(shooterID, action.Set{Movement: stay, Attack: action.RangedAttack, AttackDir: state.Right})
+	engine.Step(1)
+	var projectileID entity.ID
+	for projectileID = range engine.projectiles {
+	}
+	engine.Step(6)
+	if _, exists := engine.gameState.GetEntityPos(projectileID); !exists {
+		t.Errorf("Projectile was removed before running out of range")
+	}
+	engine.Step(1)
+	if _, exists := engine.gameState.GetEntityPos(projectileID); exists {
+		t.Errorf("Projectile wasn't removed after running out of range")
+	}
+
+	// Into the edge of the world, so it never gets going
+	engine.SetAction(shooterID, action.Set{Movement: stay, Attack: action.RangedAttack, AttackDir: state.Left})
+	engine.Step(1)
+	if len(engine.projectiles) != 0 {
+		t.Errorf("Projectile was launched off the edge of the world")
+	}
+}
+
+func TestBadAttackDirection(t *testing.T) {
+	engine := NewEngine(20, 10, WithManualTicks())
+	attackerID, attacker := addPlayerAt(t, engine, state.Coordinates{X: 5, Y: 5})
+	stay := state.Coordinates{X: 5, Y: 5}
+
+	// Directions that don't point anywhere would land on the attacker's own tile
+	for _, dir := range []state.Direction{state.MovNone, 7, -1} {
+		engine.SetAction(attackerID, action.Set{Movement: stay, Attack: action.LowAttack, AttackDir: dir})
+		engine.Step(1)
+		engine.SetAction(attackerID, action.Set{Movement: stay, Attack: action.RangedAttack, AttackDir: dir, PlaceTotem: 1})
+		engine.Step(1)
+	}
+
+	if attacker.Health != 100 {
+		t.Errorf("Attacker hit themselves. Health: %d", attacker.Health)
+	}
+	if len(engine.projectiles) != 0 {
+		t.Errorf("Projectile launched without a direction. A: %d, E: 0", len(engine.projectiles))
+	}
+	if len(engine.gameState.Totems()) != 0 {
+		t.Errorf("Totem placed without a direction. A: %v", engine.gameState.Totems())
+	}
+}
@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"log"
+
+	"github.com/VivaLaPanda/antipath/entity"
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+// A player that's been taken off the grid until they respawn
+type deadPlayer struct {
+	respawnAt uint64
+	// Where they died
+	pos state.Coordinates
+}
+
+// Takes players that ran out of health off the grid, and puts back any whose
+// respawn delay is up
+func (e *Engine) processDeaths() {
+	e.playersLock.RLock()
+	playerIDs := sortedIDs(e.players)
+	e.playersLock.RUnlock()
+
+	for _, playerID := range playerIDs {
+		e.playersLock.RLock()
+		playerData := e.players[playerID]
+		e.playersLock.RUnlock()
+		if _, alreadyDead := e.dead[playerID]; alreadyDead || !playerData.Dead() {
+			continue
+		}
+
+		pos, _ := e.gameState.GetEntityPos(playerID)
+		if _, err := e.gameState.RemoveEntity(playerID); err != nil {
+			log.Printf("Failed to remove dead player %s, err: %v", playerID, err)
+			continue
+		}
+		e.dead[playerID] = deadPlayer{respawnAt: e.Tick() + e.respawnTicks, pos: pos}
+		delete(e.fallingFrom, playerID)
+
+		e.notify(playerID, Event{Kind: Death, Tick: e.Tick(), Attacker: e.killers[playerID], Victim: playerID})
+		delete(e.killers, playerID)
+	}
+
+	for _, playerID := range sortedIDs(e.dead) {
+		if e.dead[playerID].respawnAt > e.Tick() {
+			continue
+		}
+		e.respawn(playerID)
+	}
+}
+
+// Brings a dead player back at a fresh spawn point, keeping their ID
+func (e *Engine) respawn(playerID entity.ID) {
+	e.playersLock.RLock()
+	playerData := e.players[playerID]
+	e.playersLock.RUnlock()
+
+	pos, err := e.findSpawn(playerData)
+	if err != nil {
+		// Nowhere to put them yet, they'll try again next tick
+		return
+	}
+	playerData.Respawn()
+	if err := e.gameState.PlaceEntity(playerID, playerData, pos); err != nil {
+		log.Printf("Failed to respawn player %s, err: %v", playerID, err)
+		return
+	}
+	e.standOnGround(playerData, pos)
+	delete(e.dead, playerID)
+
+	e.notify(playerID, Event{Kind: Respawn, Tick: e.Tick(), Victim: playerID})
+}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VivaLaPanda/antipath/engine/action"
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+func TestDeathAndRespawn(t *testing.T) {
+	// 10 ticks a second, so a 1 second delay is 10 ticks
+	engine := NewEngine(20, 10, WithManualTicks(), WithTickRate(10), WithRespawnDelay(time.Second))
+	attackerID, _ := addPlayerAt(t, engine, state.Coordinates{X: 5, Y: 5})
+	victimID, victim := addPlayerAt(t, engine, state.Coordinates{X: 6, Y: 5})
+	updates := make(chan *Update, 1)
+	engine.RegisterClient(victimID, updates)
+
+	// Five low attacks finishes them off
+	var update *Update
+	for idx := 0; idx < 5; idx++ {
+		engine.SetAction(attackerID, action.Set{Movement: state.Coordinates{X: 5, Y: 5}, Attack: action.LowAttack, AttackDir: state.Right})
+		engine.Step(1)
+		update = <-updates
+	}
+	diedAt := engine.Tick()
+
+	if !victim.Dead() {
+		t.Fatalf("Victim should be dead. Health: %d", victim.Health)
+	}
+	if _, exists := engine.gameState.GetEntityPos(victimID); exists {
+		t.Errorf("Dead player is still on the grid")
+	}
+
+	// The update for that tick should have told them who did it
+	if len(update.Events) != 2 || update.Events[1].Kind != Death || update.Events[1].Attacker != attackerID {
+		t.Errorf("Dead player wasn't told about their death. Events: %v", update.Events)
+	}
+
+	// While dead they keep seeing where they died
+	engine.Step(1)
+	update = <-updates
+	if update.State.Root() != (state.Coordinates{X: 1, Y: 0}) {
+		t.Errorf("Dead player's view isn't where they died. Root: %v", update.State.Root())
+	}
+
+	// Dead players can't act
+	engine.SetAction(victimID, action.Set{Movement: state.Coordinates{X: 6, Y: 6}})
+	engine.Step(int(diedAt + 9 - engine.Tick()))
+	if _, exists := engine.gameState.GetEntityPos(victimID); exists {
+		t.Errorf("Dead player respawned before the delay was up")
+	}
+
+	engine.Step(1)
+	if _, exists := engine.gameState.GetEntityPos(victimID); !exists {
+		t.Errorf("Dead player didn't respawn after the delay")
+	}
+	if victim.Health != 100 {
+		t.Errorf("Respawned player didn't get their health back. Health: %d", victim.Health)
+	}
+}
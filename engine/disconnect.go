@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"github.com/VivaLaPanda/antipath/engine/record"
+	"github.com/VivaLaPanda/antipath/entity"
+)
+
+// Tells the engine a player's client has gone away. Their body is removed
+// once the disconnect grace period is up, unless they reconnect first.
+func (e *Engine) DisconnectPlayer(entityID entity.ID) {
+	e.tickLock.Lock()
+	defer e.tickLock.Unlock()
+
+	e.disconnectPlayer(entityID)
+}
+
+// Callers must hold tickLock
+func (e *Engine) disconnectPlayer(entityID entity.ID) {
+	e.playersLock.RLock()
+	_, exists := e.players[entityID]
+	e.playersLock.RUnlock()
+	if !exists {
+		return
+	}
+	e.record(record.Event{Tick: e.Tick(), Kind: record.Leave, Player: entityID})
+
+	// Nobody's there to see what they asked for any more, so their body
+	// stands still while it waits for them
+	e.abandonInputs(entityID)
+
+	if e.graceTicks == 0 {
+		e.removePlayer(entityID)
+		return
+	}
+	e.disconnected[entityID] = e.Tick() + e.graceTicks
+}
+
+// Cancels the removal of a disconnected player. Returns false if they're
+// already gone, in which case they'll need to join again. Players that never
+// disconnected stay in the game either way. Anything still queued from their
+// last connection is thrown away, and the new one carries on numbering its
+// inputs from LastInput.
+func (e *Engine) ReconnectPlayer(entityID entity.ID) bool {
+	e.tickLock.Lock()
+	defer e.tickLock.Unlock()
+
+	e.playersLock.RLock()
+	_, exists := e.players[entityID]
+	e.playersLock.RUnlock()
+	if !exists {
+		return false
+	}
+
+	if _, waiting := e.disconnected[entityID]; waiting {
+		e.record(record.Event{Tick: e.Tick(), Kind: record.Rejoin, Player: entityID})
+		delete(e.disconnected, entityID)
+	}
+	e.abandonInputs(entityID)
+
+	return true
+}
+
+// Throws away a player's queued inputs. Callers must hold tickLock
+func (e *Engine) abandonInputs(entityID entity.ID) {
+	e.playerActionsLock.Lock()
+	defer e.playerActionsLock.Unlock()
+
+	if queue, exists := e.playerActions[entityID]; exists {
+		queue.abandon(e.lastInput[entityID])
+	}
+}
+
+// Takes a player out of the game entirely, freeing up their tile
+func (e *Engine) RemovePlayer(entityID entity.ID) {
+	e.tickLock.Lock()
+	defer e.tickLock.Unlock()
+
+	e.record(record.Event{Tick: e.Tick(), Kind: record.Remove, Player: entityID})
+	e.removePlayer(entityID)
+}
+
+// Callers must hold tickLock
+func (e *Engine) removePlayer(entityID entity.ID) {
+	if _, onGrid := e.gameState.GetEntityPos(entityID); onGrid {
+		e.gameState.RemoveEntity(entityID)
+	}
+
+	e.playersLock.Lock()
+	delete(e.players, entityID)
+	e.playersLock.Unlock()
+	e.playerActionsLock.Lock()
+	delete(e.playerActions, entityID)
+	e.playerActionsLock.Unlock()
+
+	delete(e.events, entityID)
+	delete(e.dead, entityID)
+	delete(e.killers, entityID)
+	delete(e.disconnected, entityID)
+	delete(e.fallingFrom, entityID)
+	delete(e.lastInput, entityID)
+	delete(e.owners, entityID)
+
+	for _, listener := range e.removeListeners {
+		listener(entityID)
+	}
+}
+
+// Calls `listener` with every player taken out of the game from now on,
+// whether they were removed, their grace period ran out or they were dropped
+// for being too slow with no grace period. It's called with the tick lock
+// held, so it mustn't call back into the engine.
+func (e *Engine) OnRemove(listener func(entityID entity.ID)) {
+	e.tickLock.Lock()
+	defer e.tickLock.Unlock()
+
+	e.removeListeners = append(e.removeListeners, listener)
+}
+
+// Removes disconnected players whose grace period has run out
+func (e *Engine) processDisconnects() {
+	for _, entityID := range sortedIDs(e.disconnected) {
+		if e.disconnected[entityID] <= e.Tick() {
+			e.removePlayer(entityID)
+		}
+	}
+}
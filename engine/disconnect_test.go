@@ -0,0 +1,162 @@
+package engine
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/VivaLaPanda/antipath/engine/action"
+	"github.com/VivaLaPanda/antipath/engine/record"
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+func TestDisconnectPlayer(t *testing.T) {
+	engine := NewEngine(20, 10, WithManualTicks())
+	id, _ := engine.AddPlayer()
+	pos, _ := engine.gameState.GetEntityPos(id)
+
+	engine.DisconnectPlayer(id)
+	if _, exists := engine.gameState.GetEntityPos(id); exists {
+		t.Errorf("Disconnected player is still on the grid")
+	}
+	if _, exists := engine.players[id]; exists {
+		t.Errorf("Disconnected player is still in the player list")
+	}
+	if _, exists := engine.playerActions[id]; exists {
+		t.Errorf("Disconnected player still has pending actions")
+	}
+	tile, _ := engine.gameState.GetTile(pos)
+	if tile.PeekEntity() != nil {
+		t.Errorf("Disconnected player's tile wasn't freed")
+	}
+
+	// Anything the client sent on its way out is ignored
+	engine.SetAction(id, action.Set{Movement: pos})
+	if err := engine.Step(1); err != nil {
+		t.Errorf("Ticking after a disconnect produced an error: %v", err)
+	}
+}
+
+func TestDisconnectGrace(t *testing.T) {
+	engine := NewEngine(20, 10, WithManualTicks(), WithTickRate(10), WithDisconnectGrace(time.Second))
+	id, _ := engine.AddPlayer()
+
+	engine.DisconnectPlayer(id)
+	engine.Step(9)
+	if _, exists := engine.gameState.GetEntityPos(id); !exists {
+		t.Errorf("Disconnected player was removed before their grace period was up")
+	}
+
+	// Coming back in time keeps them around
+	if !engine.ReconnectPlayer(id) {
+		t.Errorf("Reconnecting within the grace period failed")
+	}
+	engine.Step(5)
+	if _, exists := engine.gameState.GetEntityPos(id); !exists {
+		t.Errorf("Reconnected player was removed")
+	}
+
+	// Not coming back gets them removed
+	engine.DisconnectPlayer(id)
+	engine.Step(10)
+	if _, exists := engine.gameState.GetEntityPos(id); exists {
+		t.Errorf("Disconnected player wasn't removed after their grace period")
+	}
+	if engine.ReconnectPlayer(id) {
+		t.Errorf("Reconnecting after the grace period succeeded")
+	}
+}
+
+func TestDisconnectPurgesInputs(t *testing.T) {
+	engine := NewEngine(20, 10, WithManualTicks(), WithTickRate(10), WithDisconnectGrace(time.Second))
+	id, _ := addPlayerAt(t, engine, state.Coordinates{X: 10, Y: 10})
+	engine.playerActions[id] = engine.newInputQueue()
+	for seq := 1; seq <= 3; seq++ {
+		engine.SetAction(id, action.Set{Seq: uint64(seq), Movement: state.Coordinates{X: 10, Y: 10 - seq}})
+	}
+
+	// Their body waits where it was for them to come back
+	engine.DisconnectPlayer(id)
+	engine.Step(3)
+	if pos, _ := engine.gameState.GetEntityPos(id); pos != (state.Coordinates{X: 10, Y: 10}) {
+		t.Errorf("Disconnected player kept moving. A: %v, E: %v", pos, state.Coordinates{X: 10, Y: 10})
+	}
+	if stats, _ := engine.InputStats(id); stats.Abandoned != 3 || stats.Applied != 0 {
+		t.Errorf("Queued inputs weren't thrown away. A: %+v", stats)
+	}
+}
+
+func TestReconnectCarriesOnSequence(t *testing.T) {
+	engine := NewEngine(20, 10, WithManualTicks(), WithTickRate(10), WithDisconnectGrace(time.Second))
+	id, _ := addPlayerAt(t, engine, state.Coordinates{X: 10, Y: 10})
+	engine.playerActions[id] = engine.newInputQueue()
+	for seq := 1; seq <= 3; seq++ {
+		engine.SetAction(id, action.Set{Seq: uint64(seq), Movement: state.Coordinates{X: 10, Y: 10 - seq}})
+	}
+	engine.Step(1)
+	engine.DisconnectPlayer(id)
+	engine.Step(1)
+
+	// The new connection picks up after the last input that was applied
+	engine.ReconnectPlayer(id)
+	next := engine.LastInput(id) + 1
+	engine.SetAction(id, action.Set{Seq: next, Movement: state.Coordinates{X: 11, Y: 9}})
+	engine.Step(1)
+	if pos, _ := engine.gameState.GetEntityPos(id); pos != (state.Coordinates{X: 11, Y: 9}) {
+		t.Errorf("Input after reconnecting wasn't applied. A: %v, E: %v", pos, state.Coordinates{X: 11, Y: 9})
+	}
+	if engine.LastInput(id) != next {
+		t.Errorf("Wrong input acked after reconnecting. A: %d, E: %d", engine.LastInput(id), next)
+	}
+	if stats, _ := engine.InputStats(id); stats.Stale != 0 {
+		t.Errorf("Input after reconnecting was taken for a straggler. A: %+v", stats)
+	}
+}
+
+func TestReconnectReplays(t *testing.T) {
+	logBuf := &bytes.Buffer{}
+	recorder := record.NewWriter(logBuf)
+	engine := NewEngine(20, 10, WithManualTicks(), WithTickRate(10), WithDisconnectGrace(time.Second),
+		WithRecorder(recorder))
+	id, _ := engine.AddPlayer()
+
+	engine.DisconnectPlayer(id)
+	engine.Step(5)
+	engine.ReconnectPlayer(id)
+	engine.Step(10)
+	recorder.Close()
+
+	reader, err := record.NewReader(logBuf)
+	if err != nil {
+		t.Fatalf("Couldn't read log, err: %v", err)
+	}
+	replayed, err := Replay(reader, engine.Tick())
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if replayed.GetPlayer(id) == nil {
+		t.Errorf("Replay removed a player who reconnected in time")
+	}
+}
+
+func TestRegisterReplaces(t *testing.T) {
+	engine := NewEngine(20, 10, WithManualTicks())
+	id, _ := engine.AddPlayer()
+	oldReciever := make(chan *Update, 1)
+	newReciever := make(chan *Update, 1)
+
+	engine.RegisterClient(id, oldReciever)
+	engine.RegisterClient(id, newReciever)
+	if _, ok := <-oldReciever; ok {
+		t.Errorf("Replaced subscription wasn't closed")
+	}
+
+	// The old connection going away doesn't touch the new one
+	if engine.UnregisterClient(id, oldReciever) {
+		t.Errorf("Unregistering a replaced subscription reported success")
+	}
+	engine.Step(1)
+	if _, ok := <-newReciever; !ok {
+		t.Errorf("New subscription didn't get an update")
+	}
+}
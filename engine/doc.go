@@ -0,0 +1,30 @@
+// Package engine runs the simulation: it takes players' inputs, advances the
+// world a tick at a time and hands each client what it can see.
+//
+// # Concurrency
+//
+// The world has a single writer. Everything that changes the game state, the
+// tick loop and calls like AddPlayer or DisconnectPlayer alike, does so while
+// holding the engine's tick lock, so only one of them is ever running. The
+// state, players and projectiles are never read without that lock either.
+//
+// Nothing live leaves the engine. Other goroutines, client connections in
+// particular, only ever get copies made under the tick lock: each Update's
+// State is cut from a frame of the world frozen at the end of the tick, with
+// copies of everything standing on it, and its Player is a copy too.
+// GetPlayer, Snapshot and Map work the same way. A copy belongs to whoever
+// received it and never changes underneath them. Frames share the rows that
+// haven't changed, so readers mustn't change them either.
+//
+// Inputs go the other way through SetAction, which only touches the input
+// queues under their own lock, so clients never wait on a tick to send.
+// Client subscriptions have their own lock too.
+//
+// Ticks never wait on clients either. Updates go out on each client's own
+// buffered channel, and when a client's is full everything waiting on it is
+// thrown away for the latest update. A client that stays behind past the slow
+// client limit is hung up on.
+//
+// State hands out its live grid, so it's only for tools that drive a paused
+// or stopped engine themselves.
+package engine
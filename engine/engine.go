@@ -1,63 +1,429 @@
 package engine
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"math/rand"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/VivaLaPanda/antipath/engine/action"
+	"github.com/VivaLaPanda/antipath/engine/record"
 	"github.com/VivaLaPanda/antipath/entity"
 	"github.com/VivaLaPanda/antipath/entity/player"
+	"github.com/VivaLaPanda/antipath/entity/projectile"
 	"github.com/VivaLaPanda/antipath/state"
+	"github.com/VivaLaPanda/antipath/state/terrain"
 )
 
+// How many times per second the engine advances the simulation by default
+const DefaultTickRate = 20
+
+// If we fall this many ticks behind schedule we give up on catching up and
+// skip ahead instead, otherwise one slow stretch can snowball forever
+const maxCatchUpTicks = 5
+
+// What the tick loop does when a tick takes longer than its time slot
+type OverrunPolicy int
+
+const (
+	// Run the late ticks back to back until we're back on schedule
+	CatchUp OverrunPolicy = iota
+	// Drop the ticks we missed and wait for the next slot
+	Skip OverrunPolicy = iota
+)
+
+// Option configures an Engine at construction time
+type Option func(*Engine)
+
+// Sets how many ticks per second the engine runs at
+func WithTickRate(ticksPerSecond int) Option {
+	return func(e *Engine) {
+		if ticksPerSecond < 1 {
+			panic("tick rate must be at least 1 tick per second")
+		}
+		e.tickPeriod = time.Second / time.Duration(ticksPerSecond)
+	}
+}
+
+// Sets what happens when a tick overruns its time slot
+func WithOverrunPolicy(policy OverrunPolicy) Option {
+	return func(e *Engine) {
+		e.overrunPolicy = policy
+	}
+}
+
+// Starts the engine paused, so ticks only happen when Step is called or the
+// engine is resumed. Handy for tests and debugging tools.
+func WithManualTicks() Option {
+	return func(e *Engine) {
+		e.paused = true
+	}
+}
+
+// Seeds all of the engine's randomness. Two engines with the same seed fed
+// the same players and actions on the same ticks end up in the same state.
+func WithSeed(seed int64) Option {
+	return func(e *Engine) {
+		e.seed = seed
+	}
+}
+
+// Records every join, leave and applied action to `recorder` so the game can
+// be replayed later. The engine doesn't close the recorder.
+func WithRecorder(recorder *record.Writer) Option {
+	return func(e *Engine) {
+		e.recorder = recorder
+	}
+}
+
+// How long dead players wait before coming back by default
+const DefaultRespawnDelay = 3 * time.Second
+
+// Sets how long dead players wait before respawning
+func WithRespawnDelay(delay time.Duration) Option {
+	return func(e *Engine) {
+		e.respawnDelay = delay
+	}
+}
+
+// Keeps a disconnected player's body in the world for `grace` before removing
+// it, giving them a chance to reconnect. By default they're removed straight away.
+func WithDisconnectGrace(grace time.Duration) Option {
+	return func(e *Engine) {
+		e.disconnectGrace = grace
+	}
+}
+
+// Generates the world's terrain from the engine's seed using `params`,
+// instead of starting out flat
+func WithTerrain(params terrain.Params) Option {
+	return func(e *Engine) {
+		e.terrain = &params
+	}
+}
+
+// Starts the world from a map rather than an empty grid. The map's size
+// overrides the size passed to NewEngine, and it can't be combined with
+// WithTerrain.
+func WithMap(worldMap *state.Map) Option {
+	return func(e *Engine) {
+		e.worldMap = worldMap
+	}
+}
+
 type Engine struct {
-	ClientSubs        map[entity.ID]chan *state.State
+	ClientSubs        map[entity.ID]chan *Update
 	clientSubsLock    *sync.RWMutex
 	players           map[entity.ID]*player.Player
 	playersLock       *sync.RWMutex
-	playerActions     map[entity.ID]action.Set
+	playerActions     map[entity.ID]*inputQueue
 	playerActionsLock *sync.RWMutex
 	actionsToProcess  map[entity.ID]action.Set
 	gameState         *state.State
 	WindowSize        int
+	tickPeriod        time.Duration
+	overrunPolicy     OverrunPolicy
+	skippedTicks      uint64
+	runLock           *sync.Mutex
+	cancel            context.CancelFunc
+	done              chan struct{}
+	stopped           bool
+	paused            bool
+	resumed           chan struct{}
+	tickLock          *sync.Mutex
+	seed              int64
+	recorder          *record.Writer
+	respawnDelay      time.Duration
+	respawnTicks      uint64
+	disconnectGrace   time.Duration
+	graceTicks        uint64
+	terrain           *terrain.Params
+	worldMap          *state.Map
+	restoreFrom       *Snapshot
+	snapshotPath      string
+	snapshotEvery     time.Duration
+	snapshotTicks     uint64
+	// Holds a value while a snapshot is being written
+	snapshotting chan struct{}
+
+	inputBuffer    int
+	overflowPolicy OverflowPolicy
+	// Guarded by playerActionsLock
+	inputTotals InputStats
+
+	slowClientLimit time.Duration
+	slowClientTicks uint64
+	// Guarded by clientSubsLock
+	sendQueues    map[entity.ID]*sendQueue
+	sendTotals    SendStats
+	stopListeners []func()
+
+	// Everything below is only touched with tickLock held
+
+	// rand.Rand isn't safe for concurrent use
+	rand *rand.Rand
+	// Events waiting to go out in each player's next update
+	events map[entity.ID][]Event
+	// Projectiles in flight
+	projectiles map[entity.ID]*projectile.Projectile
+	// Players waiting to respawn
+	dead map[entity.ID]deadPlayer
+	// Who landed the killing blow on each player that's about to die
+	killers map[entity.ID]entity.ID
+	// When each disconnected player's body gets removed
+	disconnected map[entity.ID]uint64
+	// The altitude each airborne player started falling from
+	fallingFrom map[entity.ID]int
+	// The sequence number of the last input applied for each player
+	lastInput map[entity.ID]uint64
+	// Who to tell when a player is taken out of the game
+	removeListeners []func(entity.ID)
+	// Who signed in as each player, for players that belong to someone
+	owners map[entity.ID]string
 }
 
-func NewEngine(stateSize int, WindowSize int) *Engine {
+func NewEngine(stateSize int, WindowSize int, options ...Option) *Engine {
 	engine := &Engine{
-		ClientSubs:        make(map[entity.ID]chan *state.State),
+		ClientSubs:        make(map[entity.ID]chan *Update),
 		clientSubsLock:    &sync.RWMutex{},
 		players:           make(map[entity.ID]*player.Player),
 		playersLock:       &sync.RWMutex{},
-		playerActions:     make(map[entity.ID]action.Set),
+		playerActions:     make(map[entity.ID]*inputQueue),
 		playerActionsLock: &sync.RWMutex{},
 		actionsToProcess:  make(map[entity.ID]action.Set),
-		gameState:         state.NewState(stateSize),
+		events:            make(map[entity.ID][]Event),
+		projectiles:       make(map[entity.ID]*projectile.Projectile),
+		dead:              make(map[entity.ID]deadPlayer),
+		killers:           make(map[entity.ID]entity.ID),
+		disconnected:      make(map[entity.ID]uint64),
+		fallingFrom:       make(map[entity.ID]int),
+		lastInput:         make(map[entity.ID]uint64),
+		owners:            make(map[entity.ID]string),
+		sendQueues:        make(map[entity.ID]*sendQueue),
+		inputBuffer:       DefaultInputBuffer,
+		overflowPolicy:    DropOldest,
+		respawnDelay:      DefaultRespawnDelay,
 		WindowSize:        WindowSize,
+		tickPeriod:        time.Second / DefaultTickRate,
+		overrunPolicy:     CatchUp,
+		runLock:           &sync.Mutex{},
+		resumed:           make(chan struct{}),
+		tickLock:          &sync.Mutex{},
+		seed:              time.Now().UnixNano(),
+		snapshotting:      make(chan struct{}, 1),
+	}
+
+	for _, option := range options {
+		option(engine)
+	}
+
+	engine.respawnTicks = engine.durationToTicks(engine.respawnDelay)
+	engine.graceTicks = engine.durationToTicks(engine.disconnectGrace)
+	engine.slowClientTicks = engine.durationToTicks(engine.slowClientLimit)
+	engine.snapshotTicks = engine.durationToTicks(engine.snapshotEvery)
+	engine.rand = rand.New(rand.NewSource(engine.seed))
+	if engine.restoreFrom != nil {
+		if err := engine.restore(); err != nil {
+			panic(fmt.Sprintf("couldn't restore snapshot: %v", err))
+		}
+		if engine.recorder != nil {
+			// A replay has no way to rebuild the world we started from
+			log.Printf("Can't record a restored world, not recording")
+			engine.recorder = nil
+		}
+	} else if engine.worldMap != nil {
+		if engine.terrain != nil {
+			panic("can't start from a map and generate terrain at the same time")
+		}
+		var err error
+		stateSize = engine.worldMap.Size
+		engine.gameState, err = state.NewStateFromMap(engine.worldMap, engine.rand.Int63())
+		if err != nil {
+			panic(fmt.Sprintf("couldn't load map: %v", err))
+		}
+		engine.placeMapEntities()
+	} else {
+		engine.gameState = state.NewSeededState(stateSize, engine.rand.Int63())
+	}
+	if engine.terrain != nil && engine.restoreFrom == nil {
+		err := terrain.Generate(engine.gameState, engine.rand.Int63(), *engine.terrain)
+		if err != nil {
+			panic(fmt.Sprintf("couldn't generate terrain: %v", err))
+		}
 	}
 
-	go engine.processEvents()
+	if engine.recorder != nil {
+		err := engine.recorder.WriteHeader(record.Header{
+			Seed:         engine.seed,
+			StateSize:    stateSize,
+			WindowSize:   WindowSize,
+			Terrain:      engine.terrain,
+			Map:          engine.worldMap,
+			GraceTicks:   engine.graceTicks,
+			RespawnTicks: engine.respawnTicks,
+			TickPeriod:   engine.tickPeriod,
+		})
+		if err != nil {
+			log.Printf("Failed to start recording, err: %v", err)
+		}
+	}
 
 	return engine
 }
 
-func (e *Engine) AddPlayer() (entityID entity.ID) {
+// Starts the tick loop in the background. The loop runs until Stop is called
+// or the provided context is cancelled, whichever happens first.
+func (e *Engine) Start(ctx context.Context) {
+	e.runLock.Lock()
+	defer e.runLock.Unlock()
+	if e.done != nil {
+		panic("engine can only be started once")
+	}
+
+	ctx, e.cancel = context.WithCancel(ctx)
+	e.done = make(chan struct{})
+	go e.processEvents(ctx)
+}
+
+// Stops the tick loop and waits for it to shut down. The tick in progress is
+// allowed to finish and every client subscription is closed, which tells the
+// clients to disconnect.
+func (e *Engine) Stop() {
+	e.runLock.Lock()
+	cancel, done := e.cancel, e.done
+	e.runLock.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	} else {
+		// Never started, but the clients still need letting go
+		e.finalSnapshot()
+		e.closeClients()
+	}
+}
+
+// Halts the tick loop after the current tick. The engine can still be
+// advanced by hand with Step while paused.
+func (e *Engine) Pause() {
+	e.runLock.Lock()
+	defer e.runLock.Unlock()
+
+	e.paused = true
+}
+
+// Picks the tick loop back up after a Pause
+func (e *Engine) Resume() {
+	e.runLock.Lock()
+	defer e.runLock.Unlock()
+
+	if e.paused {
+		e.paused = false
+		close(e.resumed)
+		e.resumed = make(chan struct{})
+	}
+}
+
+func (e *Engine) Paused() bool {
+	e.runLock.Lock()
+	defer e.runLock.Unlock()
+
+	return e.paused
+}
+
+// Advances the simulation by exactly `ticks` ticks before returning. Only
+// works when the tick loop isn't driving the engine, so either before Start
+// or while paused.
+func (e *Engine) Step(ticks int) error {
+	e.runLock.Lock()
+	running := e.done != nil && !e.paused
+	e.runLock.Unlock()
+	if running {
+		return fmt.Errorf("can't step the engine while the tick loop is running, pause it first")
+	}
+
+	for ; ticks > 0; ticks-- {
+		e.tick()
+	}
+
+	return nil
+}
+
+// If the engine is paused returns a channel that closes once it's resumed,
+// otherwise nil
+func (e *Engine) pausedUntil() <-chan struct{} {
+	e.runLock.Lock()
+	defer e.runLock.Unlock()
+
+	if e.paused {
+		return e.resumed
+	}
+	return nil
+}
+
+// Closes every client subscription and stops accepting new ones
+func (e *Engine) closeClients() {
+	e.clientSubsLock.Lock()
+	e.stopped = true
+	for entityID, channel := range e.ClientSubs {
+		delete(e.ClientSubs, entityID)
+		delete(e.sendQueues, entityID)
+		close(channel)
+	}
+	listeners := e.stopListeners
+	e.stopListeners = nil
+	e.clientSubsLock.Unlock()
+
+	for _, listener := range listeners {
+		listener()
+	}
+}
+
+// Calls `listener` once the engine stops, or straight away if it already has
+func (e *Engine) OnStop(listener func()) {
+	e.clientSubsLock.Lock()
+	if !e.stopped {
+		e.stopListeners = append(e.stopListeners, listener)
+		e.clientSubsLock.Unlock()
+		return
+	}
+	e.clientSubsLock.Unlock()
+
+	listener()
+}
+
+// The seed driving all of this engine's randomness
+func (e *Engine) Seed() int64 {
+	return e.seed
+}
+
+func (e *Engine) AddPlayer() (entityID entity.ID, err error) {
+	return e.AddNamedPlayer("")
+}
+
+// Adds a player that goes by `name`. Names are just for show, players are
+// still told apart by their IDs. Fails with ErrNoSpawn if the world is full
+func (e *Engine) AddNamedPlayer(name string) (entityID entity.ID, err error) {
+	// Players join between ticks so a replay sees them arrive at the same time
+	e.tickLock.Lock()
+	defer e.tickLock.Unlock()
+
 	newPlayer := player.NewPlayer()
+	newPlayer.Name = name
 
-	// Keep trying to spawn in the player at new coords until it works
-	pos := state.Coordinates{
-		X: rand.Intn(e.gameState.Size()),
-		Y: rand.Intn(e.gameState.Size()),
+	pos, err := e.findSpawn(newPlayer)
+	if err != nil {
+		return "", err
 	}
-	entityID, err := e.gameState.NewEntity(newPlayer, pos)
-	for err != nil {
-		pos := state.Coordinates{
-			X: rand.Intn(e.gameState.Size()),
-			Y: rand.Intn(e.gameState.Size()),
-		}
-		entityID, err = e.gameState.NewEntity(newPlayer, pos)
+	entityID, err = e.gameState.NewEntity(newPlayer, pos)
+	if err != nil {
+		return "", err
 	}
+	e.standOnGround(newPlayer, pos)
 
 	e.playersLock.Lock()
 	newPlayer.PlayerID = entityID
@@ -65,62 +431,254 @@ func (e *Engine) AddPlayer() (entityID entity.ID) {
 	e.playersLock.Unlock()
 	// Set the default action
 	e.playerActionsLock.Lock()
-	e.playerActions[entityID] = action.Set{Movement: pos, Jump: false}
+	e.playerActions[entityID] = e.newInputQueue(action.Set{Movement: pos, Jump: false})
 	e.playerActionsLock.Unlock()
 
-	return entityID
+	e.record(record.Event{Tick: e.Tick(), Kind: record.Join, Player: entityID, Name: name})
+
+	return entityID, nil
 }
 
-func (e *Engine) RegisterClient(entityID entity.ID, stateReciever chan *state.State) {
+func (e *Engine) RegisterClient(entityID entity.ID, stateReciever chan *Update) {
 	e.clientSubsLock.Lock()
 	defer e.clientSubsLock.Unlock()
 
+	if e.stopped {
+		// Nothing will ever be sent, so hang up straight away
+		close(stateReciever)
+		return
+	}
+	// A new connection for the same player replaces the old one
+	if old, exists := e.ClientSubs[entityID]; exists && old != stateReciever {
+		close(old)
+	}
 	e.ClientSubs[entityID] = stateReciever
+	e.sendQueues[entityID] = &sendQueue{totals: &e.sendTotals}
 }
 
-func (e *Engine) UnregisterClient(entityID entity.ID) {
+// Drops the subscription `stateReciever` for a player, closing it. Returns
+// false if it wasn't their subscription any more, because the engine has
+// shut down or another connection has taken over the player.
+func (e *Engine) UnregisterClient(entityID entity.ID, stateReciever chan *Update) bool {
 	e.clientSubsLock.Lock()
 	defer e.clientSubsLock.Unlock()
 
-	channel := e.ClientSubs[entityID]
+	channel, exists := e.ClientSubs[entityID]
+	if !exists || channel != stateReciever {
+		return false
+	}
 	delete(e.ClientSubs, entityID)
+	delete(e.sendQueues, entityID)
 	close(channel)
+
+	return true
 }
 
+// Queues up an input for a player. Inputs with a sequence number are applied
+// in order, at most one move and one attack a tick, and any that arrive after
+// a later one are dropped. Unsequenced inputs replace whatever's queued.
 func (e *Engine) SetAction(entityID entity.ID, actionSet action.Set) {
+	// Stragglers from a client that's already been removed
+	e.playersLock.RLock()
+	_, exists := e.players[entityID]
+	e.playersLock.RUnlock()
+	if !exists {
+		return
+	}
+
 	e.playerActionsLock.Lock()
-	e.playerActions[entityID] = actionSet
-	e.playerActionsLock.Unlock()
+	defer e.playerActionsLock.Unlock()
+	queue, exists := e.playerActions[entityID]
+	if !exists {
+		e.playerActions[entityID] = e.newInputQueue(actionSet)
+		return
+	}
+	queue.push(actionSet)
+}
+
+// The number of the last tick the engine finished processing
+func (e *Engine) Tick() uint64 {
+	return e.gameState.Tick()
 }
 
-func (e *Engine) processEvents() {
+// How many ticks have been dropped because the loop fell behind schedule
+func (e *Engine) SkippedTicks() uint64 {
+	return atomic.LoadUint64(&e.skippedTicks)
+}
+
+func (e *Engine) processEvents(ctx context.Context) {
+	defer close(e.done)
+	defer e.closeClients()
+	// Runs before the clients are let go, so it knows who was connected
+	defer e.finalSnapshot()
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	due := time.Now()
 	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		if resumed := e.pausedUntil(); resumed != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-resumed:
+			}
+			// Don't try and catch up on the time we spent paused
+			due = time.Now()
+		}
+
+		e.tick()
+
+		due = e.nextDue(due, time.Now())
+		timer.Reset(time.Until(due))
+	}
+}
+
+// Runs a single step of the simulation
+func (e *Engine) tick() {
+	e.tickLock.Lock()
+	defer e.tickLock.Unlock()
+
+	e.gameState.AdvanceTick()
+	e.processDisconnects()
+	// Gravity goes before actions, so a jump gets a tick in the air
+	e.processPhysics()
+	e.processPlayerActions()
+	e.processCombat()
+	e.processProjectiles()
+	e.processTotems()
+	e.processDeaths()
+	e.updateClients()
+	e.maybeSnapshot()
+
+	if e.recorder != nil {
+		// Flush every tick so a crash loses as little of the log as possible
+		if err := e.recorder.Flush(); err != nil {
+			log.Printf("Failed to flush recording, err: %v", err)
+		}
+	}
+}
+
+// Adds an event to the recording, if there is one
+func (e *Engine) record(event record.Event) {
+	if e.recorder == nil {
+		return
+	}
+
+	if err := e.recorder.Record(event); err != nil {
+		log.Printf("Failed to record event %v, err: %v", event, err)
+	}
+}
 
-		e.processPlayerActions()
-		e.updateClients()
+// How many ticks it takes for at least `duration` to pass
+func (e *Engine) durationToTicks(duration time.Duration) uint64 {
+	return uint64((duration + e.tickPeriod - 1) / e.tickPeriod)
+}
 
-		time.Sleep(1000 * time.Millisecond)
+// Works out when the tick after the one due at `due` should start. Ticks are
+// scheduled against a fixed timeline so time spent working doesn't stretch
+// the tick period. If we're running late the overrun policy decides whether
+// to run the missed ticks immediately or drop them.
+func (e *Engine) nextDue(due time.Time, now time.Time) time.Time {
+	next := due.Add(e.tickPeriod)
+	if !now.After(next) {
+		return next
 	}
+
+	missed := int(now.Sub(next) / e.tickPeriod)
+	if e.overrunPolicy == CatchUp && missed < maxCatchUpTicks {
+		// Next tick is already late, so it'll run straight away
+		return next
+	}
+
+	// Skip every slot that's already passed, keeping our original cadence
+	skipped := missed + 1
+	atomic.AddUint64(&e.skippedTicks, uint64(skipped))
+	return next.Add(time.Duration(skipped) * e.tickPeriod)
 }
 
+// A copy of the player as of the last tick, or nil if they aren't in the game
 func (e *Engine) GetPlayer(entityID entity.ID) *player.Player {
-	return e.players[entityID]
+	e.tickLock.Lock()
+	defer e.tickLock.Unlock()
+
+	return e.copyPlayer(entityID)
+}
+
+// Marks a player as belonging to `owner`, so they can be handed back to the
+// same owner later. IDs get reused by a world started from the same seed, so
+// an ID alone doesn't say whose a player is
+func (e *Engine) SetOwner(entityID entity.ID, owner string) {
+	e.tickLock.Lock()
+	defer e.tickLock.Unlock()
+
+	e.playersLock.RLock()
+	_, exists := e.players[entityID]
+	e.playersLock.RUnlock()
+	if exists {
+		e.owners[entityID] = owner
+	}
+}
+
+// Who a player belongs to, or "" if nobody owns them or they aren't in the
+// game
+func (e *Engine) Owner(entityID entity.ID) string {
+	e.tickLock.Lock()
+	defer e.tickLock.Unlock()
+
+	return e.owners[entityID]
+}
+
+// Callers must hold tickLock
+func (e *Engine) copyPlayer(entityID entity.ID) *player.Player {
+	e.playersLock.RLock()
+	defer e.playersLock.RUnlock()
+
+	playerData, exists := e.players[entityID]
+	if !exists {
+		return nil
+	}
+
+	return playerData.Clone()
 }
 
 func (e *Engine) processPlayerActions() {
-	// Freeze actions at this time
-	e.actionsToProcess = e.playerActions
-	// Wipe old actions so they don't get reused
+	// Take this tick's inputs off each player's queue, so they can't be used
+	// twice
+	e.actionsToProcess = make(map[entity.ID]action.Set)
 	e.playerActionsLock.Lock()
-	e.playerActions = make(map[entity.ID]action.Set)
+	for entityID, queue := range e.playerActions {
+		pos, _ := e.gameState.GetEntityPos(entityID)
+		if next, queued := queue.take(pos); queued {
+			e.actionsToProcess[entityID] = next
+		}
+	}
 	e.playerActionsLock.Unlock()
 
-	for entityID, action := range e.actionsToProcess {
+	for _, entityID := range sortedIDs(e.actionsToProcess) {
+		action := e.actionsToProcess[entityID]
+		e.record(record.Event{Tick: e.Tick(), Kind: record.Act, Player: entityID, Action: action})
+		// Even if they're dead it's been dealt with, so the client can stop
+		// predicting it
+		if action.Seq != 0 {
+			e.lastInput[entityID] = action.Seq
+		}
 		var err error
 		e.playersLock.RLock()
 		playerData := e.players[entityID]
 		e.playersLock.RUnlock()
 
+		// Dead players don't get to do anything
+		pos, exists := e.gameState.GetEntityPos(entityID)
+		if !exists {
+			continue
+		}
+
 		// Process jumps
 		if action.Jump {
 			playerData.Jump()
@@ -128,7 +686,6 @@ func (e *Engine) processPlayerActions() {
 
 		// Process movement
 		// TODO: Enforce player speed
-		pos, _ := e.gameState.GetEntityPos(entityID)
 		if state.Distance(pos, action.Movement) <= playerData.Speed()*4 {
 			err = e.gameState.ChangePos(entityID, action.Movement, playerData.Altitude)
 		} else {
@@ -142,13 +699,52 @@ func (e *Engine) processPlayerActions() {
 	}
 }
 
+// Map order is random, so anything that changes the game state needs to
+// visit entities in a fixed order to keep the simulation deterministic
+func sortedIDs[V any](entities map[entity.ID]V) []entity.ID {
+	entityIDs := make([]entity.ID, 0, len(entities))
+	for entityID := range entities {
+		entityIDs = append(entityIDs, entityID)
+	}
+	sort.Slice(entityIDs, func(i, j int) bool { return entityIDs[i] < entityIDs[j] })
+
+	return entityIDs
+}
+
 func (e *Engine) updateClients() {
-	e.clientSubsLock.RLock()
-	defer e.clientSubsLock.RUnlock()
+	e.clientSubsLock.Lock()
+	defer e.clientSubsLock.Unlock()
+	// Every client's view is cut from the same frame, so the world is only
+	// copied once a tick, and only the parts that changed
+	e.gameState.Freeze()
 	for playerID, client := range e.ClientSubs {
-		select {
-		case client <- e.gameState.PeekState(playerID, e.WindowSize):
-		default:
+		update := &Update{
+			Player:    e.copyPlayer(playerID),
+			Events:    e.events[playerID],
+			LastInput: e.lastInput[playerID],
+		}
+		if body, isDead := e.dead[playerID]; isDead {
+			// Keep showing them where they died until they respawn
+			update.State = e.gameState.PeekStateAt(body.pos, e.WindowSize)
+		} else {
+			update.State = e.gameState.PeekState(playerID, e.WindowSize)
+		}
+		queue := e.sendQueues[playerID]
+		if queue.send(client, update) {
+			// Only forget the events once they've actually been sent
+			delete(e.events, playerID)
+		} else {
+			e.events[playerID] = update.Events
+		}
+		if e.slowClientTicks != 0 && queue.behind > e.slowClientTicks {
+			e.dropSlowClient(playerID)
+		}
+	}
+
+	// Nobody is listening for these, so don't let them pile up
+	for playerID := range e.events {
+		if _, subscribed := e.ClientSubs[playerID]; !subscribed {
+			delete(e.events, playerID)
 		}
 	}
 }
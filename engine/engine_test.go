@@ -1,11 +1,18 @@
 package engine
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/VivaLaPanda/antipath/engine/action"
+	"github.com/VivaLaPanda/antipath/entity"
 	"github.com/VivaLaPanda/antipath/state"
+	"github.com/VivaLaPanda/antipath/state/terrain"
 )
 
 func TestNewEngine(t *testing.T) {
@@ -15,7 +22,7 @@ func TestNewEngine(t *testing.T) {
 
 func TestAddPlayer(t *testing.T) {
 	engine := NewEngine(100, 20)
-	id := engine.AddPlayer()
+	id, _ := engine.AddPlayer()
 
 	if engine.players[id].Health != 100 {
 		t.Errorf("Newly added player has non-default values. %v", engine.players[id])
@@ -30,45 +37,44 @@ func TestAddPlayer(t *testing.T) {
 }
 
 func TestSetAction(t *testing.T) {
-	engine := NewEngine(100, 20)
-	id := engine.AddPlayer()
+	engine := NewEngine(100, 20, WithManualTicks())
+	id, _ := engine.AddPlayer()
 
 	pos, _ := engine.gameState.GetEntityPos(id)
+	expectedY := pos.Y - 50
+	if expectedY < 0 {
+		expectedY = 0
+	}
 
-	testAction := action.Set{pos, false}
+	testAction := action.Set{Movement: pos, Jump: false}
 	engine.SetAction(id, testAction)
 
 	for idx := 0; idx < 50; idx++ {
 		pos.Y -= 1
-		testAction = action.Set{pos, false}
+		testAction = action.Set{Movement: pos, Jump: false}
 		engine.SetAction(id, testAction)
-		time.Sleep(100 * time.Millisecond)
+		engine.Step(1)
+	}
+
+	newPos, _ := engine.gameState.GetEntityPos(id)
+	if newPos.Y != expectedY {
+		t.Errorf("Actions didn't move the player as expected. A: %v, E: %d", newPos, expectedY)
 	}
 
 	return
 }
 
 func TestClientSubs(t *testing.T) {
-	engine := NewEngine(50, 10)
-	id := engine.AddPlayer()
+	engine := NewEngine(50, 10, WithManualTicks())
+	id, _ := engine.AddPlayer()
 	for idx := 0; idx < 20; idx++ {
 		engine.AddPlayer()
 	}
-	stateReciever := make(chan *state.State)
+	stateReciever := make(chan *Update, 1)
 
 	// Add the subscription
 	engine.RegisterClient(id, stateReciever)
 
-	// Watch the state updates
-	go func() {
-		for {
-			_, ok := <-stateReciever
-			if !ok {
-				break
-			}
-		}
-	}()
-
 	pos, _ := engine.gameState.GetEntityPos(id)
 
 	testAction := action.Set{Movement: pos, Jump: false}
@@ -78,10 +84,397 @@ func TestClientSubs(t *testing.T) {
 		pos.Y -= 1
 		testAction = action.Set{Movement: pos, Jump: false}
 		engine.SetAction(id, testAction)
-		time.Sleep(100 * time.Millisecond)
+		engine.Step(1)
+
+		// Every tick should produce an update
+		update := <-stateReciever
+		if update.State.Tick() != engine.Tick() {
+			t.Errorf("Client got a stale update. A: %d, E: %d", update.State.Tick(), engine.Tick())
+		}
 	}
 
-	engine.UnregisterClient(id)
+	engine.UnregisterClient(id, stateReciever)
+	if _, ok := <-stateReciever; ok {
+		t.Errorf("Unregistering didn't close the subscription")
+	}
 
 	return
 }
+
+// Mostly here for the race detector. Clients read their updates while the
+// engine carries on changing the world underneath
+func TestConcurrentReaders(t *testing.T) {
+	engine := NewEngine(30, 10, WithTickRate(200))
+	ids := []entity.ID{}
+	for idx := 0; idx < 5; idx++ {
+		id, _ := engine.AddPlayer()
+		ids = append(ids, id)
+	}
+	engine.Start(context.Background())
+
+	readers := sync.WaitGroup{}
+	for _, id := range ids {
+		updates := make(chan *Update)
+		engine.RegisterClient(id, updates)
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for update := range updates {
+				if _, err := json.Marshal(update.State); err != nil {
+					t.Errorf("Failed to marshal update, err: %v", err)
+				}
+				json.Marshal(update.Player)
+			}
+		}()
+	}
+
+	deadline := time.Now().Add(200 * time.Millisecond)
+	for seq := uint64(1); time.Now().Before(deadline); seq++ {
+		engine.Map()
+		for _, saved := range engine.Snapshot().Players {
+			if engine.GetPlayer(saved.ID) == nil || saved.Pos == nil {
+				continue
+			}
+			engine.SetAction(saved.ID, action.Set{
+				Seq:       seq,
+				Movement:  state.Offset(*saved.Pos, state.Direction(seq%4), 1),
+				Jump:      seq%3 == 0,
+				Attack:    action.RangedAttack,
+				AttackDir: state.Direction(seq % 4),
+			})
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	engine.Stop()
+	readers.Wait()
+}
+
+func TestStep(t *testing.T) {
+	engine := NewEngine(50, 10, WithManualTicks())
+
+	err := engine.Step(5)
+	if err != nil {
+		t.Errorf("Stepping an engine that isn't running produced an error: %v", err)
+	}
+	if engine.Tick() != 5 {
+		t.Errorf("Step didn't advance the expected number of ticks. A: %d, E: %d", engine.Tick(), 5)
+	}
+
+	// Manual engines stay paused once started, so stepping still works
+	engine.Start(context.Background())
+	defer engine.Stop()
+	err = engine.Step(3)
+	if err != nil {
+		t.Errorf("Stepping a paused engine produced an error: %v", err)
+	}
+	if engine.Tick() != 8 {
+		t.Errorf("Step didn't advance the expected number of ticks. A: %d, E: %d", engine.Tick(), 8)
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	engine := NewEngine(50, 10, WithTickRate(100), WithManualTicks())
+	engine.Start(context.Background())
+	defer engine.Stop()
+
+	time.Sleep(50 * time.Millisecond)
+	if engine.Tick() != 0 {
+		t.Errorf("Paused engine ticked on its own. A: %d, E: %d", engine.Tick(), 0)
+	}
+
+	engine.Resume()
+	if engine.Paused() {
+		t.Errorf("Engine still paused after resuming")
+	}
+	if engine.Step(1) == nil {
+		t.Errorf("Stepping a running engine didn't produce an error")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if engine.Tick() == 0 {
+		t.Errorf("Resumed engine didn't tick")
+	}
+
+	engine.Pause()
+	time.Sleep(20 * time.Millisecond)
+	pausedAt := engine.Tick()
+	time.Sleep(50 * time.Millisecond)
+	if engine.Tick() != pausedAt {
+		t.Errorf("Engine kept ticking after being paused. A: %d, E: %d", engine.Tick(), pausedAt)
+	}
+}
+
+func TestTick(t *testing.T) {
+	engine := NewEngine(50, 10, WithTickRate(100))
+	engine.Start(context.Background())
+	defer engine.Stop()
+	id, _ := engine.AddPlayer()
+	stateReciever := make(chan *Update, 1)
+	engine.RegisterClient(id, stateReciever)
+
+	update := <-stateReciever
+	if update.State.Tick() == 0 {
+		t.Errorf("State snapshot wasn't stamped with a tick number")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if engine.Tick() <= update.State.Tick() {
+		t.Errorf("Tick number didn't increase. A: %d, Previous: %d", engine.Tick(), update.State.Tick())
+	}
+
+	engine.UnregisterClient(id, stateReciever)
+}
+
+func TestStop(t *testing.T) {
+	engine := NewEngine(50, 10, WithTickRate(100))
+	id, _ := engine.AddPlayer()
+	stateReciever := make(chan *Update, 1)
+	engine.RegisterClient(id, stateReciever)
+	engine.Start(context.Background())
+
+	<-stateReciever
+	engine.Stop()
+
+	// Drain whatever was sent before the stop, the channel must then be closed
+	for range stateReciever {
+	}
+	stoppedAt := engine.Tick()
+	time.Sleep(50 * time.Millisecond)
+	if engine.Tick() != stoppedAt {
+		t.Errorf("Engine kept ticking after being stopped. A: %d, E: %d", engine.Tick(), stoppedAt)
+	}
+
+	// Late subscribers get hung up on immediately
+	lateReciever := make(chan *Update)
+	lateID, _ := engine.AddPlayer()
+	engine.RegisterClient(lateID, lateReciever)
+	if _, ok := <-lateReciever; ok {
+		t.Errorf("Subscribing to a stopped engine didn't close the channel")
+	}
+
+	// Unregistering after shutdown is harmless
+	engine.UnregisterClient(id, stateReciever)
+	engine.Stop()
+}
+
+func TestStopWithContext(t *testing.T) {
+	engine := NewEngine(50, 10, WithTickRate(100))
+	ctx, cancel := context.WithCancel(context.Background())
+	engine.Start(ctx)
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		engine.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Engine didn't shut down after its context was cancelled")
+	}
+}
+
+func TestNextDue(t *testing.T) {
+	engine := NewEngine(10, 10, WithTickRate(10))
+	period := 100 * time.Millisecond
+	start := time.Now()
+
+	// On time, so the next tick is one period later
+	next := engine.nextDue(start, start.Add(10*time.Millisecond))
+	if next != start.Add(period) {
+		t.Errorf("On time tick scheduled wrong. A: %v, E: %v", next.Sub(start), period)
+	}
+
+	// Slightly late, catch up runs the next tick immediately
+	next = engine.nextDue(start, start.Add(2*period+period/2))
+	if next != start.Add(period) {
+		t.Errorf("Late tick didn't catch up. A: %v, E: %v", next.Sub(start), period)
+	}
+
+	// Way too late, catch up gives up and skips ahead
+	skippedBefore := engine.SkippedTicks()
+	next = engine.nextDue(start, start.Add(20*period+period/2))
+	if next != start.Add(21*period) {
+		t.Errorf("Very late tick didn't skip ahead. A: %v, E: %v", next.Sub(start), 21*period)
+	}
+	if engine.SkippedTicks()-skippedBefore != 20 {
+		t.Errorf("Skipped ticks not counted. A: %d, E: %d", engine.SkippedTicks()-skippedBefore, 20)
+	}
+
+	// Skip policy never runs late ticks
+	engine = NewEngine(10, 10, WithTickRate(10), WithOverrunPolicy(Skip))
+	next = engine.nextDue(start, start.Add(2*period+period/2))
+	if next != start.Add(3*period) {
+		t.Errorf("Skip policy ran a late tick. A: %v, E: %v", next.Sub(start), 3*period)
+	}
+	if engine.SkippedTicks() != 2 {
+		t.Errorf("Skipped ticks not counted. A: %d, E: %d", engine.SkippedTicks(), 2)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	runGame := func(seed int64) []byte {
+		engine := NewEngine(50, 10, WithManualTicks(), WithSeed(seed))
+		ids := []entity.ID{}
+		for idx := 0; idx < 10; idx++ {
+			id, _ := engine.AddPlayer()
+			ids = append(ids, id)
+		}
+
+		for tick := 0; tick < 20; tick++ {
+			for idx, id := range ids {
+				pos, _ := engine.gameState.GetEntityPos(id)
+				pos.X += (idx % 3) - 1
+				pos.Y += (tick % 3) - 1
+				engine.SetAction(id, action.Set{Movement: pos, Jump: tick%5 == 0})
+			}
+			engine.Step(1)
+		}
+
+		stateJSON, err := engine.gameState.MarshalJSON()
+		if err != nil {
+			t.Fatalf("Failed to marshal state: %v", err)
+		}
+		return stateJSON
+	}
+
+	if !bytes.Equal(runGame(42), runGame(42)) {
+		t.Errorf("Two runs with the same seed and inputs produced different states")
+	}
+	if bytes.Equal(runGame(42), runGame(43)) {
+		t.Errorf("Two runs with different seeds produced the same state")
+	}
+}
+
+func TestTerrain(t *testing.T) {
+	engine := NewEngine(50, 10, WithManualTicks(), WithTerrain(terrain.Presets["dungeon"]))
+	spawnable := make(map[state.Coordinates]bool)
+	for _, pos := range engine.gameState.SpawnPoints() {
+		spawnable[pos] = true
+	}
+
+	for idx := 0; idx < 20; idx++ {
+		id, _ := engine.AddPlayer()
+		pos, _ := engine.gameState.GetEntityPos(id)
+		if !spawnable[pos] {
+			t.Errorf("Player spawned outside the spawn points at %v", pos)
+		}
+		ground, _ := engine.gameState.GetTile(pos)
+		if engine.players[id].Altitude != ground.TerrainHeight()+1 {
+			t.Errorf("Player spawned at the wrong altitude. A: %d, E: %d", engine.players[id].Altitude, ground.TerrainHeight()+1)
+		}
+	}
+}
+
+func TestMap(t *testing.T) {
+	worldMap := &state.Map{Size: 10, Heights: make([][]int, 10)}
+	for y := range worldMap.Heights {
+		worldMap.Heights[y] = make([]int, 10)
+	}
+	worldMap.Heights[3][4] = 2
+	worldMap.Entities = []state.MapEntity{{Kind: state.PlayerEntity, Pos: state.Coordinates{X: 4, Y: 3}}}
+	engine := NewEngine(50, 10, WithManualTicks(), WithMap(worldMap))
+
+	if engine.gameState.Size() != 10 {
+		t.Errorf("Engine didn't take its size from the map. A: %d, E: %d", engine.gameState.Size(), 10)
+	}
+	saved := engine.Map()
+	if !reflect.DeepEqual(saved.Entities, worldMap.Entities) {
+		t.Errorf("Map entities weren't placed. A: %v, E: %v", saved.Entities, worldMap.Entities)
+	}
+	for _, playerData := range engine.players {
+		if playerData.Altitude != 3 {
+			t.Errorf("Map player isn't standing on the ground. A: %d, E: %d", playerData.Altitude, 3)
+		}
+	}
+}
+
+func TestCrowdedSpawn(t *testing.T) {
+	engine := NewEngine(3, 10, WithManualTicks())
+	ids := []entity.ID{}
+	for idx := 0; idx < 9; idx++ {
+		id, err := engine.AddPlayer()
+		if err != nil {
+			t.Fatalf("Couldn't add player %d to a world with room, err: %v", idx, err)
+		}
+		ids = append(ids, id)
+	}
+
+	added := make(chan error)
+	go func() {
+		_, err := engine.AddPlayer()
+		added <- err
+	}()
+	select {
+	case err := <-added:
+		if err != ErrNoSpawn {
+			t.Errorf("Full world took another player. A: %v, E: %v", err, ErrNoSpawn)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Adding a player to a full world never returned")
+	}
+
+	// A player that dies while the world fills up waits for room to respawn
+	deadID := ids[0]
+	pos, _ := engine.gameState.GetEntityPos(deadID)
+	engine.gameState.RemoveEntity(deadID)
+	engine.dead[deadID] = deadPlayer{respawnAt: engine.Tick(), pos: pos}
+	if _, err := engine.AddPlayer(); err != nil {
+		t.Fatalf("Couldn't take the dead player's tile, err: %v", err)
+	}
+	engine.Step(1)
+	if _, waiting := engine.dead[deadID]; !waiting {
+		t.Errorf("Dead player respawned into a full world")
+	}
+
+	engine.RemovePlayer(ids[1])
+	engine.Step(1)
+	if _, exists := engine.gameState.GetEntityPos(deadID); !exists {
+		t.Errorf("Dead player didn't respawn once there was room")
+	}
+}
+
+func TestMapSpawnsOccupied(t *testing.T) {
+	worldMap := &state.Map{Size: 10, Heights: make([][]int, 10)}
+	for y := range worldMap.Heights {
+		worldMap.Heights[y] = make([]int, 10)
+	}
+	worldMap.Spawns = []state.Coordinates{{X: 2, Y: 2}, {X: 7, Y: 7}}
+	worldMap.Entities = []state.MapEntity{
+		{Kind: state.PlayerEntity, Pos: state.Coordinates{X: 2, Y: 2}},
+		{Kind: state.PlayerEntity, Pos: state.Coordinates{X: 7, Y: 7}},
+	}
+	if worldMap.FreeSpawns() != 0 {
+		t.Errorf("Occupied spawns counted as free. A: %d, E: 0", worldMap.FreeSpawns())
+	}
+	engine := NewEngine(50, 10, WithManualTicks(), WithMap(worldMap))
+
+	// With every spawn point taken there's no room, even though there's
+	// plenty of space off them
+	added := make(chan error)
+	go func() {
+		_, err := engine.AddPlayer()
+		added <- err
+	}()
+	select {
+	case err := <-added:
+		if err != ErrNoSpawn {
+			t.Errorf("Player was added off the spawn points. A: %v, E: %v", err, ErrNoSpawn)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Adding players to a map with its spawns taken never returned")
+	}
+	if len(engine.players) != 2 {
+		t.Errorf("Wrong number of players. A: %d, E: %d", len(engine.players), 2)
+	}
+
+	// Once one frees up it's used
+	freed := engine.gameState.SpawnPoints()[1]
+	freedTile, _ := engine.gameState.PeekTile(freed)
+	engine.RemovePlayer(freedTile.PeekEntity().ID())
+	id, err := engine.AddPlayer()
+	if pos, _ := engine.gameState.GetEntityPos(id); err != nil || pos != freed {
+		t.Errorf("Player didn't take the free spawn point. A: %v, E: %v, Err: %v", pos, freed, err)
+	}
+}
@@ -0,0 +1,199 @@
+package engine
+
+import (
+	"github.com/VivaLaPanda/antipath/engine/action"
+	"github.com/VivaLaPanda/antipath/entity"
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+// What to do with an input that arrives when a player's buffer is full
+type OverflowPolicy int
+
+const (
+	// Throw away the oldest queued input to make room. A client that far
+	// ahead has lost track of the server, so its newest inputs matter most
+	DropOldest OverflowPolicy = iota
+	// Throw away the input that just arrived
+	DropNewest OverflowPolicy = iota
+)
+
+// How many inputs a player can have waiting by default
+const DefaultInputBuffer = 64
+
+// Sets how many inputs each player can have waiting, and what happens to the
+// ones that don't fit
+func WithInputBuffer(size int, policy OverflowPolicy) Option {
+	return func(e *Engine) {
+		if size < 1 {
+			panic("input buffer must hold at least 1 input")
+		}
+		e.inputBuffer = size
+		e.overflowPolicy = policy
+	}
+}
+
+// InputStats counts what happened to the inputs players sent
+type InputStats struct {
+	// Accepted into the buffer
+	Queued uint64
+	// Taken off the buffer and applied, possibly along with others in the
+	// same tick
+	Applied uint64
+	// Thrown away because the buffer was full
+	Overflowed uint64
+	// Thrown away because they arrived after a later input
+	Stale uint64
+	// Thrown away because an unsequenced input replaced them
+	Replaced uint64
+	// Thrown away because the player disconnected before they were applied
+	Abandoned uint64
+}
+
+// Inputs that never got applied
+func (stats InputStats) Dropped() uint64 {
+	return stats.Overflowed + stats.Stale + stats.Replaced + stats.Abandoned
+}
+
+// The inputs a player has sent that haven't been applied yet, oldest first.
+// Only touched with playerActionsLock held
+type inputQueue struct {
+	pending []action.Set
+	// The newest sequence number queued, so repeats and stragglers that
+	// arrive out of order can be dropped
+	lastQueued uint64
+	limit      int
+	policy     OverflowPolicy
+	stats      InputStats
+	// The engine wide counts, kept alongside this player's
+	totals *InputStats
+}
+
+// Callers must hold playerActionsLock
+func (e *Engine) newInputQueue(pending ...action.Set) *inputQueue {
+	queue := &inputQueue{limit: e.inputBuffer, policy: e.overflowPolicy, totals: &e.inputTotals}
+	for _, input := range pending {
+		queue.push(input)
+	}
+
+	return queue
+}
+
+// Adds an input to the back of the queue
+func (queue *inputQueue) push(input action.Set) {
+	if input.Seq == 0 {
+		// Unsequenced clients just want their latest input applied
+		queue.count(func(stats *InputStats) { stats.Replaced += uint64(len(queue.pending)) })
+		queue.pending = append(queue.pending[:0], input)
+		queue.count(func(stats *InputStats) { stats.Queued++ })
+		return
+	}
+	if input.Seq <= queue.lastQueued {
+		queue.count(func(stats *InputStats) { stats.Stale++ })
+		return
+	}
+
+	queue.lastQueued = input.Seq
+	if len(queue.pending) >= queue.limit {
+		queue.count(func(stats *InputStats) { stats.Overflowed++ })
+		if queue.policy == DropNewest {
+			return
+		}
+		queue.pending = queue.pending[1:]
+	}
+	queue.pending = append(queue.pending, input)
+	queue.count(func(stats *InputStats) { stats.Queued++ })
+}
+
+// Takes this tick's inputs off the front of the queue, merged into one. A tick
+// gets at most one move and one attack, so inputs are taken in order until
+// the next one would be a second of either. `pos` is where the player is
+// standing, so inputs that leave them there don't count as a move.
+func (queue *inputQueue) take(pos state.Coordinates) (action.Set, bool) {
+	if len(queue.pending) == 0 {
+		return action.Set{}, false
+	}
+
+	merged := queue.pending[0]
+	moved := moves(merged, pos)
+	attacked := attacks(merged)
+	taken := 1
+	for ; taken < len(queue.pending); taken++ {
+		next := queue.pending[taken]
+		nextMoves, nextAttacks := moves(next, merged.Movement), attacks(next)
+		if (nextMoves && moved) || (nextAttacks && attacked) {
+			break
+		}
+
+		if nextMoves {
+			merged.Movement, merged.Jump = next.Movement, next.Jump
+			moved = true
+		}
+		if nextAttacks {
+			merged.Attack, merged.AttackDir, merged.PlaceTotem = next.Attack, next.AttackDir, next.PlaceTotem
+			attacked = true
+		}
+		merged.Seq = next.Seq
+	}
+	queue.pending = queue.pending[taken:]
+	queue.count(func(stats *InputStats) { stats.Applied += uint64(taken) })
+
+	return merged, true
+}
+
+// Throws away everything queued, so the next input accepted is the one after
+// `lastApplied`, the last one the engine actually applied
+func (queue *inputQueue) abandon(lastApplied uint64) {
+	queue.count(func(stats *InputStats) { stats.Abandoned += uint64(len(queue.pending)) })
+	queue.pending = nil
+	queue.lastQueued = lastApplied
+}
+
+// Whether `input` takes a player standing at `pos` anywhere
+func moves(input action.Set, pos state.Coordinates) bool {
+	return input.Movement != pos || input.Jump
+}
+
+func attacks(input action.Set) bool {
+	return input.Attack != action.NoAttack || input.PlaceTotem != 0
+}
+
+func (queue *inputQueue) count(update func(stats *InputStats)) {
+	update(&queue.stats)
+	update(queue.totals)
+}
+
+func (queue *inputQueue) copyPending() []action.Set {
+	return append([]action.Set(nil), queue.pending...)
+}
+
+// The sequence number of the last input the engine applied for `entityID`.
+// Inputs after it are still queued.
+func (e *Engine) LastInput(entityID entity.ID) uint64 {
+	e.tickLock.Lock()
+	defer e.tickLock.Unlock()
+
+	return e.lastInput[entityID]
+}
+
+// What's happened to the inputs `entityID` has sent. False if they aren't in
+// the game.
+func (e *Engine) InputStats(entityID entity.ID) (InputStats, bool) {
+	e.playerActionsLock.RLock()
+	defer e.playerActionsLock.RUnlock()
+
+	queue, exists := e.playerActions[entityID]
+	if !exists {
+		return InputStats{}, false
+	}
+
+	return queue.stats, true
+}
+
+// What's happened to every input sent since the engine started, including
+// those from players who've since left
+func (e *Engine) TotalInputStats() InputStats {
+	e.playerActionsLock.RLock()
+	defer e.playerActionsLock.RUnlock()
+
+	return e.inputTotals
+}
@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/VivaLaPanda/antipath/engine/action"
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+func TestInputSequencing(t *testing.T) {
+	engine := NewEngine(20, 10, WithManualTicks())
+	id, _ := engine.AddPlayer()
+	// Use up the input they join with
+	engine.Step(1)
+	engine.gameState.ChangePos(id, state.Coordinates{X: 10, Y: 10}, 0)
+	updates := make(chan *Update, 1)
+	engine.RegisterClient(id, updates)
+
+	// Queued inputs come off one a tick, in order
+	for seq := 1; seq <= 3; seq++ {
+		engine.SetAction(id, action.Set{Seq: uint64(seq), Movement: state.Coordinates{X: 10, Y: 10 - seq}})
+	}
+	// Anything older than what's queued is a straggler
+	engine.SetAction(id, action.Set{Seq: 2, Movement: state.Coordinates{X: 12, Y: 10}})
+
+	for seq := 1; seq <= 3; seq++ {
+		engine.Step(1)
+		update := <-updates
+		pos, _ := engine.gameState.GetEntityPos(id)
+		if pos.Y != 10-seq || pos.X != 10 {
+			t.Errorf("Input %d wasn't applied in order. A: %v, E: %v", seq, pos, state.Coordinates{X: 10, Y: 10 - seq})
+		}
+		if update.LastInput != uint64(seq) || engine.LastInput(id) != uint64(seq) {
+			t.Errorf("Wrong input acked. A: %d, E: %d", update.LastInput, seq)
+		}
+	}
+
+	// With nothing queued the player stays put, and the ack stays where it was
+	engine.Step(1)
+	<-updates
+	if pos, _ := engine.gameState.GetEntityPos(id); pos.Y != 7 {
+		t.Errorf("Player moved without any input. A: %v", pos)
+	}
+	if engine.LastInput(id) != 3 {
+		t.Errorf("Ack moved without any input. A: %d, E: 3", engine.LastInput(id))
+	}
+
+	// Unsequenced inputs skip the queue
+	engine.SetAction(id, action.Set{Seq: 4, Movement: state.Coordinates{X: 10, Y: 6}})
+	engine.SetAction(id, action.Set{Movement: state.Coordinates{X: 11, Y: 7}})
+	engine.Step(1)
+	if pos, _ := engine.gameState.GetEntityPos(id); pos.X != 11 || pos.Y != 7 {
+		t.Errorf("Unsequenced input didn't replace the queue. A: %v", pos)
+	}
+}
+
+func TestInputBuffer(t *testing.T) {
+	for _, policy := range []OverflowPolicy{DropOldest, DropNewest} {
+		engine := NewEngine(20, 10, WithManualTicks(), WithInputBuffer(8, policy))
+		id, _ := engine.AddPlayer()
+		engine.Step(1)
+		pos, _ := engine.gameState.GetEntityPos(id)
+
+		for seq := 1; seq <= 10; seq++ {
+			engine.SetAction(id, action.Set{Seq: uint64(seq), Movement: pos, Jump: true})
+		}
+		engine.SetAction(id, action.Set{Seq: 3, Movement: pos})
+
+		stats, _ := engine.InputStats(id)
+		if stats.Overflowed != 2 || stats.Stale != 1 || stats.Dropped() != 3 {
+			t.Errorf("Dropped inputs weren't counted. A: %+v", stats)
+		}
+		// Each input jumps, so they come off one a tick
+		engine.Step(1)
+		expected := uint64(3)
+		if policy == DropNewest {
+			expected = 1
+		}
+		if engine.LastInput(id) != expected {
+			t.Errorf("Buffer dropped the wrong end. Policy: %d, A: %d, E: %d", policy, engine.LastInput(id), expected)
+		}
+		if engine.TotalInputStats().Overflowed != 2 {
+			t.Errorf("Engine totals missed the overflow. A: %+v", engine.TotalInputStats())
+		}
+	}
+}
+
+func TestOneMoveOneAttack(t *testing.T) {
+	engine := NewEngine(20, 10, WithManualTicks())
+	id, _ := engine.AddPlayer()
+	engine.Step(1)
+	engine.gameState.ChangePos(id, state.Coordinates{X: 10, Y: 10}, 0)
+	here := state.Coordinates{X: 10, Y: 10}
+	up := state.Coordinates{X: 10, Y: 9}
+
+	// A move then an attack from where it leaves them go together
+	engine.SetAction(id, action.Set{Seq: 1, Movement: up})
+	engine.SetAction(id, action.Set{Seq: 2, Movement: up, Attack: action.RangedAttack, AttackDir: state.Up})
+	// But a second move waits for the next tick
+	engine.SetAction(id, action.Set{Seq: 3, Movement: here})
+	engine.Step(1)
+
+	if pos, _ := engine.gameState.GetEntityPos(id); pos != up {
+		t.Errorf("Player didn't make their first move. A: %v, E: %v", pos, up)
+	}
+	if len(engine.projectiles) != 1 {
+		t.Errorf("Attack wasn't applied with the move. A: %d projectiles, E: 1", len(engine.projectiles))
+	}
+	if engine.LastInput(id) != 2 {
+		t.Errorf("Wrong input acked. A: %d, E: 2", engine.LastInput(id))
+	}
+
+	engine.Step(1)
+	if pos, _ := engine.gameState.GetEntityPos(id); pos != here || engine.LastInput(id) != 3 {
+		t.Errorf("Second move wasn't applied the next tick. A: %v, E: %v", pos, here)
+	}
+}
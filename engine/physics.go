@@ -0,0 +1,64 @@
+package engine
+
+import (
+	"github.com/VivaLaPanda/antipath/entity"
+)
+
+const (
+	// How far airborne players fall each tick
+	gravity = 1
+	// Players can drop this far without getting hurt
+	safeFallHeight = 2
+	// Damage taken for every level fallen beyond safeFallHeight
+	fallDamagePerLevel = 10
+)
+
+// Pulls airborne players back down towards the ground under them, hurting
+// them if they fell a long way
+func (e *Engine) processPhysics() {
+	e.playersLock.RLock()
+	playerIDs := sortedIDs(e.players)
+	e.playersLock.RUnlock()
+
+	for _, playerID := range playerIDs {
+		pos, onGrid := e.gameState.GetEntityPos(playerID)
+		if !onGrid {
+			continue
+		}
+		e.playersLock.RLock()
+		playerData := e.players[playerID]
+		e.playersLock.RUnlock()
+
+		groundTile, _ := e.gameState.PeekTile(pos)
+		playerData.SetGround(groundTile.TerrainHeight() + 1)
+		if !playerData.Airborne() {
+			delete(e.fallingFrom, playerID)
+			continue
+		}
+
+		if _, falling := e.fallingFrom[playerID]; !falling {
+			e.fallingFrom[playerID] = playerData.Altitude
+		}
+		playerData.Fall(gravity)
+
+		if !playerData.Airborne() {
+			e.land(playerID, e.fallingFrom[playerID]-playerData.Altitude)
+			delete(e.fallingFrom, playerID)
+		}
+	}
+}
+
+// Applies fall damage to a player that just dropped `distance` levels
+func (e *Engine) land(playerID entity.ID, distance int) {
+	if distance <= safeFallHeight {
+		return
+	}
+
+	e.playersLock.RLock()
+	playerData := e.players[playerID]
+	e.playersLock.RUnlock()
+
+	damage := uint((distance - safeFallHeight) * fallDamagePerLevel)
+	playerData.Damage(damage)
+	e.notify(playerID, Event{Kind: Fall, Tick: e.Tick(), Victim: playerID, Damage: damage})
+}
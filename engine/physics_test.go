@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/VivaLaPanda/antipath/engine/action"
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+func TestJumpAndLand(t *testing.T) {
+	engine := NewEngine(20, 10, WithManualTicks())
+	pos := state.Coordinates{X: 5, Y: 5}
+	id, jumper := addPlayerAt(t, engine, pos)
+
+	engine.SetAction(id, action.Set{Movement: pos, Jump: true})
+	engine.Step(1)
+	if !jumper.Airborne() {
+		t.Fatalf("Player didn't leave the ground. Altitude: %d", jumper.Altitude)
+	}
+
+	engine.Step(1)
+	if jumper.Airborne() || jumper.Altitude != 1 {
+		t.Errorf("Player didn't come back down. Altitude: %d", jumper.Altitude)
+	}
+	if jumper.Health != 100 {
+		t.Errorf("A normal jump did fall damage. Health: %d", jumper.Health)
+	}
+}
+
+func TestFallDamage(t *testing.T) {
+	engine := NewEngine(20, 10, WithManualTicks())
+	cliff := state.Coordinates{X: 5, Y: 5}
+	cliffTile, _ := engine.gameState.GetTile(cliff)
+	cliffTile.SetHeight(5)
+	id, faller := addPlayerAt(t, engine, cliff)
+	faller.Altitude = 6
+	updates := make(chan *Update, 1)
+	engine.RegisterClient(id, updates)
+
+	// Standing on top of the cliff is fine
+	engine.Step(1)
+	<-updates
+	if faller.Airborne() || faller.Altitude != 6 {
+		t.Fatalf("Player standing on a cliff fell. Altitude: %d", faller.Altitude)
+	}
+
+	// Walk off the edge
+	engine.SetAction(id, action.Set{Movement: state.Coordinates{X: 6, Y: 5}})
+	engine.Step(1)
+	<-updates
+	var update *Update
+	for idx := 0; idx < 5; idx++ {
+		engine.Step(1)
+		update = <-updates
+		if idx < 4 && !faller.Airborne() {
+			t.Errorf("Player landed too soon. Altitude: %d", faller.Altitude)
+		}
+	}
+	if faller.Altitude != 1 {
+		t.Errorf("Player didn't land on the ground below the cliff. Altitude: %d", faller.Altitude)
+	}
+	if faller.Health != 70 {
+		t.Errorf("Wrong fall damage. A: %d, E: %d", faller.Health, 70)
+	}
+
+	if len(update.Events) != 1 || update.Events[0].Kind != Fall || update.Events[0].Damage != 30 {
+		t.Errorf("Player wasn't told about their fall damage. Events: %v", update.Events)
+	}
+}
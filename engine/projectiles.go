@@ -0,0 +1,78 @@
+package engine
+
+import (
+	"log"
+
+	"github.com/VivaLaPanda/antipath/entity"
+	"github.com/VivaLaPanda/antipath/entity/projectile"
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+// Fires a projectile from `pos`. It appears on the neighbouring tile in `dir`,
+// unless something is already there in which case that gets hit straight away.
+func (e *Engine) launchProjectile(owner entity.ID, pos state.Coordinates, dir state.Direction, altitude int) {
+	newProjectile := projectile.NewProjectile(owner, dir, altitude)
+	launchPos := state.Offset(pos, dir, 1)
+	if e.projectileBlocked(newProjectile, launchPos) {
+		return
+	}
+
+	projectileID, err := e.gameState.NewEntity(newProjectile, launchPos)
+	if err != nil {
+		log.Printf("Failed to launch projectile at %v, err: %v", launchPos, err)
+		return
+	}
+	newProjectile.ProjectileID = projectileID
+	e.projectiles[projectileID] = newProjectile
+}
+
+// Moves every projectile along its path, damaging whatever it runs into and
+// removing it once it hits something or runs out of range
+func (e *Engine) processProjectiles() {
+	for _, projectileID := range sortedIDs(e.projectiles) {
+		flying := e.projectiles[projectileID]
+		landed := false
+		for step := 0; step < flying.Speed(); step++ {
+			pos, _ := e.gameState.GetEntityPos(projectileID)
+			nextPos := state.Offset(pos, flying.Direction, 1)
+			if e.projectileBlocked(flying, nextPos) {
+				landed = true
+				break
+			}
+			e.gameState.ChangePos(projectileID, nextPos, flying.Altitude)
+		}
+
+		if landed || !flying.Fly() {
+			e.removeProjectile(projectileID)
+		}
+	}
+}
+
+// Checks whether a projectile can fly into `pos`. If there's a player in the
+// way they get hit, as does a totem. Anything else stops it dead.
+func (e *Engine) projectileBlocked(flying *projectile.Projectile, pos state.Coordinates) bool {
+	targetTile, err := e.gameState.PeekTile(pos)
+	if err != nil {
+		// Flew off the edge of the world
+		return true
+	}
+
+	if target := targetTile.PeekEntity(); target != nil {
+		// Projectiles are thin, so they only need to reach the altitude they fly at
+		stats := attackStats{damage: flying.Damage(), minReach: 0, maxReach: 1}
+		e.hitPlayer(flying.Owner, target.ID(), flying.Altitude, stats)
+		return true
+	}
+	if e.hitTotem(flying.Owner, pos, flying.Damage()) {
+		return true
+	}
+
+	return targetTile.WillCollide(flying.Altitude)
+}
+
+func (e *Engine) removeProjectile(projectileID entity.ID) {
+	delete(e.projectiles, projectileID)
+	if _, err := e.gameState.RemoveEntity(projectileID); err != nil {
+		log.Printf("Failed to remove projectile %s, err: %v", projectileID, err)
+	}
+}
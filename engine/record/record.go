@@ -0,0 +1,174 @@
+package record
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/VivaLaPanda/antipath/engine/action"
+	"github.com/VivaLaPanda/antipath/entity"
+	"github.com/VivaLaPanda/antipath/state"
+	"github.com/VivaLaPanda/antipath/state/terrain"
+)
+
+// Describes the engine a log was recorded against, which is everything needed
+// to build an identical engine to replay it on
+type Header struct {
+	Seed       int64
+	StateSize  int
+	WindowSize int
+	// Nil if the world started out flat
+	Terrain *terrain.Params
+	// Nil unless the world started from a map
+	Map *state.Map
+	// How many ticks disconnected players were kept around for
+	GraceTicks uint64
+	// How many ticks dead players waited to respawn
+	RespawnTicks uint64
+	// How long each tick was. Zero in logs from before it was recorded
+	TickPeriod time.Duration
+}
+
+// What sort of thing happened in an Event
+type Kind uint8
+
+const (
+	// A player was added to the game after Tick finished
+	Join Kind = iota
+	// A player disconnected after Tick finished
+	Leave Kind = iota
+	// Action was applied to a player during Tick
+	Act Kind = iota
+	// A player was taken out of the game outright after Tick finished
+	Remove Kind = iota
+	// A disconnected player came back before being removed, after Tick finished
+	Rejoin Kind = iota
+)
+
+// One thing that happened to the game that can't be worked out from the seed
+type Event struct {
+	Tick   uint64
+	Kind   Kind
+	Player entity.ID
+	Action action.Set
+	// What a joining player is called
+	Name string
+}
+
+// Writer records events to a log. It's safe for concurrent use.
+type Writer struct {
+	lock    *sync.Mutex
+	buf     *bufio.Writer
+	encoder *gob.Encoder
+	closer  io.Closer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	buf := bufio.NewWriter(w)
+	return &Writer{
+		lock:    &sync.Mutex{},
+		buf:     buf,
+		encoder: gob.NewEncoder(buf),
+	}
+}
+
+// Creates a log file at path, replacing anything already there
+func Create(path string) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	writer := NewWriter(file)
+	writer.closer = file
+	return writer, nil
+}
+
+// Must be called once, before any events are recorded
+func (w *Writer) WriteHeader(header Header) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.encoder.Encode(header)
+}
+
+func (w *Writer) Record(event Event) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.encoder.Encode(event)
+}
+
+// Pushes any buffered events through to the underlying writer
+func (w *Writer) Flush() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.buf.Flush()
+}
+
+// Flushes the log, and closes the file if the writer came from Create
+func (w *Writer) Close() error {
+	err := w.Flush()
+	if w.closer != nil {
+		if closeErr := w.closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// Reader reads back a log made by Writer
+type Reader struct {
+	Header  Header
+	decoder *gob.Decoder
+	closer  io.Closer
+}
+
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{decoder: gob.NewDecoder(bufio.NewReader(r))}
+	if err := reader.decoder.Decode(&reader.Header); err != nil {
+		return nil, fmt.Errorf("couldn't read log header, err: %s", err)
+	}
+
+	return reader, nil
+}
+
+func Open(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	reader.closer = file
+	return reader, nil
+}
+
+// Returns the next event in the log, or io.EOF once there are none left
+func (r *Reader) Next() (event Event, err error) {
+	err = r.decoder.Decode(&event)
+	if err == io.ErrUnexpectedEOF {
+		// The server died mid write, treat what we have as the whole log
+		err = io.EOF
+	}
+
+	return event, err
+}
+
+func (r *Reader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package record
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/VivaLaPanda/antipath/engine/action"
+	"github.com/VivaLaPanda/antipath/state"
+	"github.com/VivaLaPanda/antipath/state/terrain"
+)
+
+func TestRoundTrip(t *testing.T) {
+	buf := &bytes.Buffer{}
+	writer := NewWriter(buf)
+	header := Header{Seed: 42, StateSize: 100, WindowSize: 20, Terrain: &terrain.Params{HillHeight: 3, HillScale: 5}}
+	events := []Event{
+		{Tick: 0, Kind: Join, Player: "a"},
+		{Tick: 1, Kind: Act, Player: "a", Action: action.Set{Movement: state.Coordinates{X: 1, Y: 2}, Jump: true}},
+		{Tick: 3, Kind: Leave, Player: "a"},
+	}
+
+	if err := writer.WriteHeader(header); err != nil {
+		t.Fatalf("Writing header produced an error: %v", err)
+	}
+	for _, event := range events {
+		if err := writer.Record(event); err != nil {
+			t.Fatalf("Recording event produced an error: %v", err)
+		}
+	}
+	writer.Close()
+
+	reader, err := NewReader(buf)
+	if err != nil {
+		t.Fatalf("Reading log produced an error: %v", err)
+	}
+	if reader.Header.Seed != header.Seed || *reader.Header.Terrain != *header.Terrain {
+		t.Errorf("Header didn't survive the round trip. A: %v, E: %v", reader.Header, header)
+	}
+	for _, expected := range events {
+		event, err := reader.Next()
+		if err != nil {
+			t.Fatalf("Reading event produced an error: %v", err)
+		}
+		if event != expected {
+			t.Errorf("Event didn't survive the round trip. A: %v, E: %v", event, expected)
+		}
+	}
+	if _, err := reader.Next(); err != io.EOF {
+		t.Errorf("Reading past the last event didn't produce EOF, err: %v", err)
+	}
+}
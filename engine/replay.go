@@ -0,0 +1,94 @@
+package engine
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/VivaLaPanda/antipath/engine/record"
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+// Rebuilds the game recorded in `log` on a fresh engine, stopping once tick
+// `untilTick` has been processed. The returned engine is paused, so it can be
+// inspected or stepped further. Any options are applied on top of the ones
+// needed to match the recording.
+func Replay(log *record.Reader, untilTick uint64, options ...Option) (*Engine, error) {
+	header := log.Header
+	options = append(options, WithSeed(header.Seed), WithManualTicks())
+	if header.Terrain != nil {
+		options = append(options, WithTerrain(*header.Terrain))
+	}
+	if header.Map != nil {
+		options = append(options, WithMap(header.Map))
+	}
+	e := NewEngine(header.StateSize, header.WindowSize, options...)
+	// Whether a Leave removes the player straight away depends on this
+	e.graceTicks = header.GraceTicks
+	// And when the dead come back on this. Older logs don't have it, they
+	// were all recorded with the defaults
+	if header.TickPeriod != 0 {
+		e.tickPeriod = header.TickPeriod
+		e.respawnTicks = header.RespawnTicks
+	}
+
+	for {
+		event, err := log.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return e, fmt.Errorf("couldn't read event after tick %d, err: %s", e.Tick(), err)
+		}
+
+		// Actions are applied during their tick, everything else happens
+		// after its tick is done
+		happensAfter := event.Tick
+		if event.Kind == record.Act {
+			happensAfter--
+		}
+		if happensAfter >= untilTick {
+			break
+		}
+		e.stepTo(happensAfter)
+
+		switch event.Kind {
+		case record.Join:
+			entityID, err := e.AddNamedPlayer(event.Name)
+			if err != nil {
+				return e, fmt.Errorf("replay diverged at tick %d, player %s couldn't join, err: %v",
+					e.Tick(), event.Player, err)
+			}
+			if entityID != event.Player {
+				return e, fmt.Errorf("replay diverged at tick %d, expected player %s to join but got %s",
+					e.Tick(), event.Player, entityID)
+			}
+		case record.Leave:
+			e.DisconnectPlayer(event.Player)
+		case record.Act:
+			e.SetAction(event.Player, event.Action)
+		case record.Remove:
+			e.RemovePlayer(event.Player)
+		case record.Rejoin:
+			e.ReconnectPlayer(event.Player)
+		default:
+			return e, fmt.Errorf("unknown event kind %d at tick %d", event.Kind, event.Tick)
+		}
+	}
+
+	e.stepTo(untilTick)
+
+	return e, nil
+}
+
+// Steps a paused engine forward until it's processed tick `target`
+func (e *Engine) stepTo(target uint64) {
+	if e.Tick() < target {
+		e.Step(int(target - e.Tick()))
+	}
+}
+
+// The engine's live game state. Only safe to use while the engine is paused
+// or stopped.
+func (e *Engine) State() *state.State {
+	return e.gameState
+}
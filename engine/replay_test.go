@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/VivaLaPanda/antipath/engine/action"
+	"github.com/VivaLaPanda/antipath/engine/record"
+	"github.com/VivaLaPanda/antipath/state"
+	"github.com/VivaLaPanda/antipath/state/terrain"
+)
+
+func TestReplay(t *testing.T) {
+	logBuf := &bytes.Buffer{}
+	recorder := record.NewWriter(logBuf)
+	engine := NewEngine(50, 10, WithManualTicks(), WithRecorder(recorder),
+		WithTerrain(terrain.Params{HillHeight: 3, HillScale: 8}))
+
+	// Play a game with players coming and going between ticks
+	snapshots := map[uint64][]byte{}
+	id, _ := engine.AddPlayer()
+	for tick := 0; tick < 30; tick++ {
+		if tick%10 == 5 {
+			engine.AddPlayer()
+		}
+		pos, _ := engine.gameState.GetEntityPos(id)
+		pos.X += (tick % 3) - 1
+		pos.Y -= 1
+		engine.SetAction(id, action.Set{Movement: pos, Jump: tick%4 == 0})
+		engine.Step(1)
+
+		snapshots[engine.Tick()], _ = engine.gameState.MarshalJSON()
+	}
+	recorder.Close()
+
+	for _, tick := range []uint64{1, 6, 15, 30} {
+		reader, err := record.NewReader(bytes.NewReader(logBuf.Bytes()))
+		if err != nil {
+			t.Fatalf("Failed to read recording: %v", err)
+		}
+
+		replayed, err := Replay(reader, tick)
+		if err != nil {
+			t.Fatalf("Replay produced an error: %v", err)
+		}
+		if replayed.Tick() != tick {
+			t.Errorf("Replay stopped at the wrong tick. A: %d, E: %d", replayed.Tick(), tick)
+		}
+
+		replayedJSON, _ := replayed.State().MarshalJSON()
+		if !bytes.Equal(replayedJSON, snapshots[tick]) {
+			t.Errorf("Replayed state at tick %d doesn't match the original", tick)
+		}
+	}
+}
+
+func TestReplayRespawnDelay(t *testing.T) {
+	worldMap := &state.Map{Size: 20, Heights: make([][]int, 20)}
+	for y := range worldMap.Heights {
+		worldMap.Heights[y] = make([]int, 20)
+	}
+	worldMap.Entities = []state.MapEntity{
+		{Kind: state.PlayerEntity, Pos: state.Coordinates{X: 5, Y: 5}},
+		{Kind: state.PlayerEntity, Pos: state.Coordinates{X: 6, Y: 5}},
+	}
+	logBuf := &bytes.Buffer{}
+	recorder := record.NewWriter(logBuf)
+	engine := NewEngine(20, 10, WithManualTicks(), WithRecorder(recorder), WithMap(worldMap),
+		WithTickRate(10), WithRespawnDelay(200*time.Millisecond))
+
+	// Beat the victim to death, then wait long enough for them to come back
+	attackerTile, _ := engine.gameState.PeekTile(state.Coordinates{X: 5, Y: 5})
+	attackerID := attackerTile.PeekEntity().ID()
+	snapshots := map[uint64][]byte{}
+	for tick := 0; tick < 10; tick++ {
+		engine.SetAction(attackerID, action.Set{Movement: state.Coordinates{X: 5, Y: 5}, Attack: action.LowAttack, AttackDir: state.Right})
+		engine.Step(1)
+		snapshots[engine.Tick()], _ = engine.gameState.MarshalJSON()
+	}
+	recorder.Close()
+
+	for _, tick := range []uint64{5, 7, 10} {
+		reader, err := record.NewReader(bytes.NewReader(logBuf.Bytes()))
+		if err != nil {
+			t.Fatalf("Failed to read recording: %v", err)
+		}
+		replayed, err := Replay(reader, tick)
+		if err != nil {
+			t.Fatalf("Replay produced an error: %v", err)
+		}
+		if replayed.respawnTicks != engine.respawnTicks {
+			t.Errorf("Replay has the wrong respawn delay. A: %d, E: %d", replayed.respawnTicks, engine.respawnTicks)
+		}
+
+		replayedJSON, _ := replayed.State().MarshalJSON()
+		if !bytes.Equal(replayedJSON, snapshots[tick]) {
+			t.Errorf("Replayed state at tick %d doesn't match the original", tick)
+		}
+	}
+}
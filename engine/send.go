@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/VivaLaPanda/antipath/entity"
+)
+
+// Hangs up on clients that haven't kept up with their updates for longer than
+// `limit`, and disconnects their player. By default slow clients are kept
+// however far behind they get.
+func WithSlowClientLimit(limit time.Duration) Option {
+	return func(e *Engine) {
+		e.slowClientLimit = limit
+	}
+}
+
+// SendStats counts what happened to the updates meant for clients
+type SendStats struct {
+	// Put on the client's queue
+	Queued uint64
+	// Thrown away unsent because a newer update came along first
+	Skipped uint64
+	// Clients hung up on for falling too far behind. Only counted in the
+	// totals
+	TooSlow uint64
+}
+
+// How a client is keeping up with its updates. Only touched with
+// clientSubsLock held
+type sendQueue struct {
+	stats SendStats
+	// How many ticks in a row the client's queue has been full
+	behind uint64
+	// The engine wide counts, kept alongside this client's
+	totals *SendStats
+}
+
+// Puts `update` on a client's queue. A client whose queue is full is behind,
+// and everything waiting for it is out of date, so it's all thrown away and
+// `update` goes on in its place, carrying the thrown away updates' events
+// with it. Returns false if there wasn't room even then, in which case the
+// events in `update` still need sending.
+func (queue *sendQueue) send(channel chan *Update, update *Update) bool {
+	select {
+	case channel <- update:
+		queue.behind = 0
+		queue.count(func(stats *SendStats) { stats.Queued++ })
+		return true
+	default:
+	}
+
+	queue.behind++
+	var events []Event
+	for drained := false; !drained; {
+		select {
+		case stale := <-channel:
+			events = append(events, stale.Events...)
+			queue.count(func(stats *SendStats) { stats.Skipped++ })
+		default:
+			drained = true
+		}
+	}
+	if len(events) > 0 {
+		update.Events = append(events, update.Events...)
+	}
+
+	select {
+	case channel <- update:
+		queue.count(func(stats *SendStats) { stats.Queued++ })
+		return true
+	default:
+		queue.count(func(stats *SendStats) { stats.Skipped++ })
+		return false
+	}
+}
+
+func (queue *sendQueue) count(update func(stats *SendStats)) {
+	update(&queue.stats)
+	update(queue.totals)
+}
+
+// Hangs up on a client that's fallen too far behind and disconnects their
+// player. Callers must hold tickLock and clientSubsLock
+func (e *Engine) dropSlowClient(entityID entity.ID) {
+	close(e.ClientSubs[entityID])
+	delete(e.ClientSubs, entityID)
+	delete(e.sendQueues, entityID)
+	e.sendTotals.TooSlow++
+
+	e.disconnectPlayer(entityID)
+}
+
+// What's happened to the updates meant for `entityID`'s client. False if they
+// don't have one.
+func (e *Engine) ClientStats(entityID entity.ID) (SendStats, bool) {
+	e.clientSubsLock.RLock()
+	defer e.clientSubsLock.RUnlock()
+
+	queue, exists := e.sendQueues[entityID]
+	if !exists {
+		return SendStats{}, false
+	}
+
+	return queue.stats, true
+}
+
+// What's happened to every update meant for a client since the engine
+// started, including clients that have since gone
+func (e *Engine) TotalClientStats() SendStats {
+	e.clientSubsLock.RLock()
+	defer e.clientSubsLock.RUnlock()
+
+	return e.sendTotals
+}
+
+// Whether the engine has been stopped. Clients subscribed to a stopped engine
+// have been hung up on
+func (e *Engine) Stopped() bool {
+	e.clientSubsLock.RLock()
+	defer e.clientSubsLock.RUnlock()
+
+	return e.stopped
+}
@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSendCoalescing(t *testing.T) {
+	engine := NewEngine(20, 10, WithManualTicks())
+	id, _ := engine.AddPlayer()
+	updates := make(chan *Update, 2)
+	engine.RegisterClient(id, updates)
+
+	// Nobody's reading, so the queue fills up and gets cut back to the latest
+	for tick := 1; tick <= 5; tick++ {
+		engine.notify(id, Event{Kind: Hit, Tick: uint64(tick)})
+		engine.Step(1)
+	}
+
+	if len(updates) != 1 {
+		t.Fatalf("Queue wasn't coalesced. A: %d, E: 1", len(updates))
+	}
+	update := <-updates
+	if update.State.Tick() != engine.Tick() {
+		t.Errorf("Queued update isn't the latest. A: %d, E: %d", update.State.Tick(), engine.Tick())
+	}
+	// The events from the updates that got thrown away come along with it
+	if len(update.Events) != 5 || update.Events[0].Tick != 1 || update.Events[4].Tick != 5 {
+		t.Errorf("Events were lost when coalescing. A: %v", update.Events)
+	}
+
+	stats, _ := engine.ClientStats(id)
+	if stats.Queued != 5 || stats.Skipped != 4 {
+		t.Errorf("Wrong send stats. A: %+v, E: 5 queued, 4 skipped", stats)
+	}
+	if engine.TotalClientStats() != stats {
+		t.Errorf("Totals don't match the only client. A: %+v, E: %+v", engine.TotalClientStats(), stats)
+	}
+}
+
+func TestSlowClientDropped(t *testing.T) {
+	engine := NewEngine(20, 10, WithManualTicks(), WithTickRate(10), WithSlowClientLimit(300*time.Millisecond))
+	slowID, _ := engine.AddPlayer()
+	slow := make(chan *Update, 1)
+	engine.RegisterClient(slowID, slow)
+	keepingUpID, _ := engine.AddPlayer()
+	keepingUp := make(chan *Update, 1)
+	engine.RegisterClient(keepingUpID, keepingUp)
+
+	// The slow client's queue is full from the second tick on, so it's behind
+	// for 3 ticks by the fourth and gets dropped on the fifth
+	for tick := 1; tick <= 4; tick++ {
+		engine.Step(1)
+		<-keepingUp
+	}
+	if _, subscribed := engine.ClientStats(slowID); !subscribed {
+		t.Fatalf("Client was dropped before it hit the limit")
+	}
+	engine.Step(1)
+	<-keepingUp
+
+	<-slow
+	if _, ok := <-slow; ok {
+		t.Errorf("Slow client wasn't hung up on")
+	}
+	if engine.GetPlayer(slowID) != nil {
+		t.Errorf("Slow client's player wasn't disconnected")
+	}
+	if engine.GetPlayer(keepingUpID) == nil {
+		t.Errorf("Client that kept up was disconnected")
+	}
+	if engine.TotalClientStats().TooSlow != 1 {
+		t.Errorf("Dropped client wasn't counted. A: %d, E: 1", engine.TotalClientStats().TooSlow)
+	}
+	// Hanging up after the engine already has is fine
+	if engine.UnregisterClient(slowID, slow) {
+		t.Errorf("Unregistered a client that was already dropped")
+	}
+}
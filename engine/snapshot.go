@@ -0,0 +1,281 @@
+package engine
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/VivaLaPanda/antipath/atomicfile"
+	"github.com/VivaLaPanda/antipath/engine/action"
+	"github.com/VivaLaPanda/antipath/entity"
+	"github.com/VivaLaPanda/antipath/entity/player"
+	"github.com/VivaLaPanda/antipath/entity/projectile"
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+// Snapshot is everything needed to pick a world back up where it left off
+type Snapshot struct {
+	Tick uint64
+	// The seed the world was first made with
+	Seed int64
+	// Terrain, alignment, totems and spawn points. Entities are kept below
+	World       *state.Map
+	Players     []SavedPlayer
+	Projectiles []SavedProjectile
+}
+
+type SavedPlayer struct {
+	ID   entity.ID
+	Name string
+	// Who signed in as them, if anyone
+	Owner     string
+	Health    uint
+	Alignment int
+	Altitude  int
+	Ground    int
+	// Inputs waiting to be applied, and the sequence numbers of the newest
+	// one queued and the last one applied
+	Inputs     []action.Set
+	LastQueued uint64
+	LastInput  uint64
+	// Nil while they're dead
+	Pos *state.Coordinates
+	// Only set while dead
+	RespawnAt uint64
+	DiedAt    state.Coordinates
+	// Only set while falling
+	FallingFrom *int
+	// Whether they had a client attached. Clients don't survive a restart,
+	// so connected players get the disconnect grace period to come back
+	Connected bool
+	// Only set if they've disconnected and are waiting to be removed
+	RemoveAt uint64
+}
+
+type SavedProjectile struct {
+	ID        entity.ID
+	Owner     entity.ID
+	Direction state.Direction
+	Altitude  int
+	TicksLeft int
+	Pos       state.Coordinates
+}
+
+// Writes a snapshot of the world to `path` every `every`, and once more when
+// the engine stops. Each write replaces the last one atomically, so a crash
+// mid write leaves the previous snapshot intact.
+func WithSnapshots(path string, every time.Duration) Option {
+	return func(e *Engine) {
+		e.snapshotPath = path
+		e.snapshotEvery = every
+	}
+}
+
+// Starts the engine from a snapshot instead of a fresh world. The snapshot
+// decides the world's size, terrain and seed, so it overrides WithSeed, WithMap
+// and WithTerrain.
+func WithSnapshot(snapshot *Snapshot) Option {
+	return func(e *Engine) {
+		e.restoreFrom = snapshot
+	}
+}
+
+// Captures the whole world as it stands between ticks
+func (e *Engine) Snapshot() *Snapshot {
+	e.tickLock.Lock()
+	defer e.tickLock.Unlock()
+
+	return e.snapshot()
+}
+
+// Callers must hold tickLock
+func (e *Engine) snapshot() *Snapshot {
+	snapshot := &Snapshot{
+		Tick:  e.Tick(),
+		Seed:  e.seed,
+		World: e.gameState.Map(),
+	}
+
+	e.clientSubsLock.RLock()
+	e.playersLock.RLock()
+	e.playerActionsLock.RLock()
+	for _, playerID := range sortedIDs(e.players) {
+		playerData := e.players[playerID]
+		saved := SavedPlayer{
+			ID:        playerID,
+			Name:      playerData.Name,
+			Owner:     e.owners[playerID],
+			Health:    playerData.Health,
+			Alignment: playerData.Alignment(),
+			Altitude:  playerData.Altitude,
+			Ground:    playerData.Ground(),
+			LastInput: e.lastInput[playerID],
+			RemoveAt:  e.disconnected[playerID],
+		}
+		if queue, exists := e.playerActions[playerID]; exists {
+			saved.Inputs = queue.copyPending()
+			saved.LastQueued = queue.lastQueued
+		}
+		if pos, onGrid := e.gameState.GetEntityPos(playerID); onGrid {
+			saved.Pos = &pos
+		}
+		if dead, isDead := e.dead[playerID]; isDead {
+			saved.RespawnAt = dead.respawnAt
+			saved.DiedAt = dead.pos
+		}
+		if fallingFrom, falling := e.fallingFrom[playerID]; falling {
+			saved.FallingFrom = &fallingFrom
+		}
+		_, saved.Connected = e.ClientSubs[playerID]
+
+		snapshot.Players = append(snapshot.Players, saved)
+	}
+	e.playerActionsLock.RUnlock()
+	e.playersLock.RUnlock()
+	e.clientSubsLock.RUnlock()
+
+	for _, projectileID := range sortedIDs(e.projectiles) {
+		flying := e.projectiles[projectileID]
+		pos, _ := e.gameState.GetEntityPos(projectileID)
+		snapshot.Projectiles = append(snapshot.Projectiles, SavedProjectile{
+			ID:        projectileID,
+			Owner:     flying.Owner,
+			Direction: flying.Direction,
+			Altitude:  flying.Altitude,
+			TicksLeft: flying.TicksLeft,
+			Pos:       pos,
+		})
+	}
+
+	return snapshot
+}
+
+// Rebuilds the world from `e.restoreFrom`, keeping every entity's ID. Called
+// from NewEngine in place of building a fresh world.
+func (e *Engine) restore() error {
+	snapshot := e.restoreFrom
+	e.seed = snapshot.Seed
+	// Carry on from a different point in the random stream than the world
+	// started at, otherwise we'd mint the same entity IDs all over again
+	e.rand = rand.New(rand.NewSource(snapshot.Seed + int64(snapshot.Tick)))
+
+	gameState, err := state.NewStateFromMap(snapshot.World, e.rand.Int63())
+	if err != nil {
+		return fmt.Errorf("snapshot has a bad world, err: %s", err)
+	}
+	gameState.SetTick(snapshot.Tick)
+	e.gameState = gameState
+
+	for _, saved := range snapshot.Players {
+		restored := player.NewPlayer()
+		restored.PlayerID = saved.ID
+		restored.Name = saved.Name
+		restored.Health = saved.Health
+		restored.SetAlignment(saved.Alignment)
+		restored.Altitude = saved.Altitude
+		restored.SetGround(saved.Ground)
+
+		if saved.Pos != nil {
+			if err := e.gameState.PlaceEntity(saved.ID, restored, *saved.Pos); err != nil {
+				return fmt.Errorf("couldn't put player %s back, err: %s", saved.ID, err)
+			}
+		} else {
+			e.dead[saved.ID] = deadPlayer{respawnAt: saved.RespawnAt, pos: saved.DiedAt}
+		}
+		if saved.Owner != "" {
+			e.owners[saved.ID] = saved.Owner
+		}
+		if saved.FallingFrom != nil {
+			e.fallingFrom[saved.ID] = *saved.FallingFrom
+		}
+		switch {
+		case saved.RemoveAt != 0:
+			e.disconnected[saved.ID] = saved.RemoveAt
+		case saved.Connected:
+			e.disconnected[saved.ID] = snapshot.Tick + e.graceTicks
+		}
+
+		e.players[saved.ID] = restored
+		queue := e.newInputQueue()
+		queue.pending, queue.lastQueued = saved.Inputs, saved.LastQueued
+		e.playerActions[saved.ID] = queue
+		if saved.LastInput != 0 {
+			e.lastInput[saved.ID] = saved.LastInput
+		}
+	}
+
+	for _, saved := range snapshot.Projectiles {
+		restored := projectile.NewProjectile(saved.Owner, saved.Direction, saved.Altitude)
+		restored.ProjectileID = saved.ID
+		restored.TicksLeft = saved.TicksLeft
+		if err := e.gameState.PlaceEntity(saved.ID, restored, saved.Pos); err != nil {
+			return fmt.Errorf("couldn't put projectile %s back, err: %s", saved.ID, err)
+		}
+		e.projectiles[saved.ID] = restored
+	}
+
+	return nil
+}
+
+// Takes a snapshot if one is due this tick and writes it out in the
+// background. If the last one is still being written this one is skipped.
+// Callers must hold tickLock
+func (e *Engine) maybeSnapshot() {
+	if e.snapshotPath == "" || e.snapshotTicks == 0 || e.Tick()%e.snapshotTicks != 0 {
+		return
+	}
+
+	select {
+	case e.snapshotting <- struct{}{}:
+	default:
+		log.Printf("Skipping snapshot at tick %d, the last one is still being written", e.Tick())
+		return
+	}
+	snapshot := e.snapshot()
+	go func() {
+		defer func() { <-e.snapshotting }()
+		if err := SaveSnapshot(e.snapshotPath, snapshot); err != nil {
+			log.Printf("Failed to save snapshot, err: %v", err)
+		}
+	}()
+}
+
+// Writes one last snapshot on the way out, once any write in progress is done
+func (e *Engine) finalSnapshot() {
+	if e.snapshotPath == "" {
+		return
+	}
+
+	e.snapshotting <- struct{}{}
+	defer func() { <-e.snapshotting }()
+	if err := SaveSnapshot(e.snapshotPath, e.Snapshot()); err != nil {
+		log.Printf("Failed to save final snapshot, err: %v", err)
+	}
+}
+
+// Writes a snapshot to `path` atomically, so a crash part way through leaves
+// the last one in place
+func SaveSnapshot(path string, snapshot *Snapshot) error {
+	return atomicfile.Write(path, func(w io.Writer) error {
+		return gob.NewEncoder(w).Encode(snapshot)
+	})
+}
+
+func LoadSnapshot(path string) (*Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	snapshot := &Snapshot{}
+	if err := gob.NewDecoder(file).Decode(snapshot); err != nil {
+		return nil, fmt.Errorf("couldn't decode snapshot, err: %s", err)
+	}
+
+	return snapshot, nil
+}
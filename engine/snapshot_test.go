@@ -0,0 +1,91 @@
+package engine
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VivaLaPanda/antipath/engine/action"
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	engine := NewEngine(30, 10, WithManualTicks(), WithTickRate(10), WithDisconnectGrace(time.Second))
+	hill, _ := engine.gameState.GetTile(state.Coordinates{X: 12, Y: 3})
+	hill.SetHeight(4)
+	attackerID, _ := addPlayerAt(t, engine, state.Coordinates{X: 5, Y: 5})
+	victimID, _ := addPlayerAt(t, engine, state.Coordinates{X: 6, Y: 5})
+	engine.RegisterClient(attackerID, make(chan *Update, 100))
+	engine.SetOwner(victimID, "victim")
+	engine.gameState.PlaceTotem(state.Coordinates{X: 20, Y: 20}, -100)
+
+	// Kill someone and leave a projectile in the air
+	for idx := 0; idx < 5; idx++ {
+		engine.SetAction(attackerID, action.Set{Movement: state.Coordinates{X: 5, Y: 5}, Attack: action.LowAttack, AttackDir: state.Right})
+		engine.Step(1)
+	}
+	engine.SetAction(attackerID, action.Set{Movement: state.Coordinates{X: 5, Y: 5}, Attack: action.RangedAttack, AttackDir: state.Down})
+	engine.Step(1)
+	if len(engine.projectiles) != 1 {
+		t.Fatalf("Test setup didn't leave a projectile flying. A: %d, E: %d", len(engine.projectiles), 1)
+	}
+
+	path := filepath.Join(t.TempDir(), "world.snap")
+	if err := SaveSnapshot(path, engine.Snapshot()); err != nil {
+		t.Fatalf("Failed to save snapshot, err: %v", err)
+	}
+	snapshot, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("Failed to load snapshot, err: %v", err)
+	}
+	restored := NewEngine(50, 10, WithManualTicks(), WithTickRate(10), WithDisconnectGrace(time.Second), WithSnapshot(snapshot))
+
+	before, _ := engine.gameState.MarshalJSON()
+	after, _ := restored.gameState.MarshalJSON()
+	if !bytes.Equal(before, after) {
+		t.Errorf("Restored world doesn't match the one that was saved")
+	}
+	if restored.Seed() != engine.Seed() {
+		t.Errorf("Restored world lost its seed. A: %d, E: %d", restored.Seed(), engine.Seed())
+	}
+	if restored.Owner(victimID) != "victim" {
+		t.Errorf("Restored player lost their owner. A: %q, E: %q", restored.Owner(victimID), "victim")
+	}
+	victimDeath, isDead := restored.dead[victimID]
+	if !isDead {
+		t.Fatalf("Dead player came back alive")
+	}
+
+	// Their client didn't survive the restart, so they get the grace period
+	if _, waiting := restored.disconnected[attackerID]; !waiting {
+		t.Errorf("Connected player wasn't given a chance to reconnect")
+	}
+	restored.Step(10)
+	if restored.GetPlayer(attackerID) != nil {
+		t.Errorf("Connected player wasn't removed after the grace period")
+	}
+
+	// The victim still respawns under the same ID
+	restored.Step(int(victimDeath.respawnAt - restored.Tick()))
+	if _, onGrid := restored.gameState.GetEntityPos(victimID); !onGrid {
+		t.Errorf("Dead player didn't respawn in the restored world")
+	}
+}
+
+func TestPeriodicSnapshots(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "world.snap")
+	engine := NewEngine(20, 10, WithManualTicks(), WithTickRate(10), WithSnapshots(path, time.Second))
+	engine.AddPlayer()
+
+	engine.Step(10)
+	engine.Stop()
+
+	snapshot, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("No snapshot was written, err: %v", err)
+	}
+	if snapshot.Tick != 10 || len(snapshot.Players) != 1 {
+		t.Errorf("Snapshot doesn't match the world. Tick: %d, Players: %d", snapshot.Tick, len(snapshot.Players))
+	}
+}
@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"errors"
+
+	"github.com/VivaLaPanda/antipath/entity/player"
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+// If we can't find a spot with nobody nearby after this many tries, any free
+// tile will do
+const maxSafeSpawnAttempts = 50
+
+// After this many random picks come up occupied, we stop guessing and search
+// for a free tile in order
+const maxSpawnAttempts = 200
+
+// Returned when the world is too crowded to fit another player
+var ErrNoSpawn = errors.New("no free tile to spawn on")
+
+// Picks a random free tile to put `playerData` on, out of the world's spawn
+// points if it has any. Prefers tiles with nobody right next to them, but
+// settles for any free tile if the world is crowded. Players never go off the
+// spawn points, since that could leave them somewhere they can't get out of,
+// so once those are all taken there's no room.
+// Callers must hold tickLock
+func (e *Engine) findSpawn(playerData *player.Player) (state.Coordinates, error) {
+	spawnPoints := e.gameState.SpawnPoints()
+	for attempt := 0; attempt < maxSpawnAttempts; attempt++ {
+		var pos state.Coordinates
+		if len(spawnPoints) > 0 {
+			pos = spawnPoints[e.rand.Intn(len(spawnPoints))]
+		} else {
+			pos = state.Coordinates{
+				X: e.rand.Intn(e.gameState.Size()),
+				Y: e.rand.Intn(e.gameState.Size()),
+			}
+		}
+		spawnTile, _ := e.gameState.PeekTile(pos)
+		if spawnTile.PeekEntity() != nil {
+			continue
+		}
+
+		if attempt >= maxSafeSpawnAttempts || e.spawnIsSafe(pos) {
+			return pos, nil
+		}
+	}
+
+	if len(spawnPoints) > 0 {
+		return e.findFreeSpawnPoint(spawnPoints)
+	}
+	return e.findFreeTile(playerData.JumpHeight())
+}
+
+// The first of `spawnPoints` with nobody on it
+// Callers must hold tickLock
+func (e *Engine) findFreeSpawnPoint(spawnPoints []state.Coordinates) (state.Coordinates, error) {
+	for _, pos := range spawnPoints {
+		spawnTile, err := e.gameState.PeekTile(pos)
+		if err == nil && spawnTile.PeekEntity() == nil {
+			return pos, nil
+		}
+	}
+
+	return state.Coordinates{}, ErrNoSpawn
+}
+
+// Looks through every tile, starting from a random one, for one that's empty
+// and that a player who can jump `jumpHeight` could walk onto from next door.
+// Only for worlds without spawn points, where anywhere goes.
+// Callers must hold tickLock
+func (e *Engine) findFreeTile(jumpHeight int) (state.Coordinates, error) {
+	size := e.gameState.Size()
+	start := e.rand.Intn(size * size)
+	for idx := 0; idx < size*size; idx++ {
+		pos := state.Coordinates{X: (start + idx) % size, Y: (start + idx) / size % size}
+		freeTile, _ := e.gameState.PeekTile(pos)
+		if freeTile.PeekEntity() == nil && e.walkable(pos, freeTile.TerrainHeight(), jumpHeight) {
+			return pos, nil
+		}
+	}
+
+	return state.Coordinates{}, ErrNoSpawn
+}
+
+// Whether a tile `height` high at `pos` can be climbed onto from any of its
+// neighbours, so we don't drop anyone on top of a wall
+func (e *Engine) walkable(pos state.Coordinates, height int, jumpHeight int) bool {
+	for _, dir := range []state.Direction{state.Up, state.Right, state.Left, state.Down} {
+		neighbour, err := e.gameState.PeekTile(state.Offset(pos, dir, 1))
+		if err == nil && neighbour.TerrainHeight()+jumpHeight >= height {
+			return true
+		}
+	}
+
+	// A world one tile across has nowhere to walk from
+	return e.gameState.Size() == 1
+}
+
+// Whether every tile next to `pos` is empty
+func (e *Engine) spawnIsSafe(pos state.Coordinates) bool {
+	for _, dir := range []state.Direction{state.Up, state.Right, state.Left, state.Down} {
+		neighbour, err := e.gameState.PeekTile(state.Offset(pos, dir, 1))
+		if err == nil && neighbour.PeekEntity() != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Puts a freshly spawned player's feet on the ground of the tile they're on
+func (e *Engine) standOnGround(playerData *player.Player, pos state.Coordinates) {
+	groundTile, _ := e.gameState.PeekTile(pos)
+	ground := groundTile.TerrainHeight() + 1
+	playerData.SetGround(ground)
+	playerData.Altitude = ground
+}
@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"github.com/VivaLaPanda/antipath/entity"
+	"github.com/VivaLaPanda/antipath/entity/player"
+	"github.com/VivaLaPanda/antipath/state"
+	"github.com/VivaLaPanda/antipath/state/tile"
+)
+
+// How far a player's alignment moves towards the tile under them each tick
+const alignmentDriftRate = 1
+
+// Totems pull on the tiles around them, and the tiles pull on the players
+// standing on them
+func (e *Engine) processTotems() {
+	e.gameState.SpreadAlignment()
+
+	e.playersLock.RLock()
+	playerIDs := sortedIDs(e.players)
+	e.playersLock.RUnlock()
+	for _, playerID := range playerIDs {
+		pos, onGrid := e.gameState.GetEntityPos(playerID)
+		if !onGrid {
+			continue
+		}
+		e.playersLock.RLock()
+		playerData := e.players[playerID]
+		e.playersLock.RUnlock()
+
+		standingOn, _ := e.gameState.PeekTile(pos)
+		playerData.DriftAlignment(standingOn.Alignment(), alignmentDriftRate)
+	}
+}
+
+// Has `placer` put a fully charged totem at `pos`. Only the sign of
+// `alignment` matters. Totems only go where the placer could step or jump to,
+// so they can't be put on top of walls
+func (e *Engine) placeTotem(placer *player.Player, pos state.Coordinates, alignment int) {
+	totemTile, err := e.gameState.PeekTile(pos)
+	if err != nil || totemTile.TerrainHeight() >= placer.Altitude+placer.JumpHeight() {
+		return
+	}
+
+	totemAlignment := tile.MaxAlignment
+	if alignment < 0 {
+		totemAlignment = -tile.MaxAlignment
+	}
+
+	// Placing onto another totem just doesn't happen
+	e.gameState.PlaceTotem(pos, totemAlignment)
+}
+
+// Damages the totem at `pos` if there is one. Returns whether there was.
+func (e *Engine) hitTotem(attackerID entity.ID, pos state.Coordinates, damage uint) bool {
+	destroyed, err := e.gameState.DamageTotem(pos, int(damage))
+	if err != nil {
+		return false
+	}
+
+	hit := Event{Kind: TotemHit, Tick: e.Tick(), Attacker: attackerID, Damage: damage, Pos: &pos}
+	if destroyed {
+		hit.Kind = TotemDestroyed
+	}
+	e.notify(attackerID, hit)
+
+	return true
+}
@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/VivaLaPanda/antipath/engine/action"
+	"github.com/VivaLaPanda/antipath/state"
+	"github.com/VivaLaPanda/antipath/state/tile"
+)
+
+func TestTotems(t *testing.T) {
+	engine := NewEngine(20, 10, WithManualTicks())
+	pos := state.Coordinates{X: 5, Y: 5}
+	totemPos := state.Coordinates{X: 5, Y: 4}
+	id, placer := addPlayerAt(t, engine, pos)
+	updates := make(chan *Update, 1)
+	engine.RegisterClient(id, updates)
+
+	engine.SetAction(id, action.Set{Movement: pos, AttackDir: state.Up, PlaceTotem: 1})
+	engine.Step(1)
+	<-updates
+	totemTile, _ := engine.gameState.GetTile(totemPos)
+	if !totemTile.HasTotem() || totemTile.Alignment() != tile.MaxAlignment {
+		t.Fatalf("Totem wasn't placed. Health: %d, Alignment: %d", totemTile.TotemHealth(), totemTile.Alignment())
+	}
+
+	// The totem pulls on the player's tile, which pulls on the player
+	engine.Step(3)
+	<-updates
+	standingOn, _ := engine.gameState.GetTile(pos)
+	if standingOn.Alignment() <= 0 {
+		t.Errorf("Totem didn't pull on a nearby tile. Alignment: %d", standingOn.Alignment())
+	}
+	if placer.Alignment() <= 0 {
+		t.Errorf("Player didn't drift towards their tile's alignment. Alignment: %d", placer.Alignment())
+	}
+
+	// Smash it
+	for totemTile.HasTotem() {
+		engine.SetAction(id, action.Set{Movement: pos, AttackDir: state.Up, Attack: action.LowAttack})
+		engine.Step(1)
+		update := <-updates
+		if len(update.Events) != 1 || update.Events[0].Pos == nil || *update.Events[0].Pos != totemPos {
+			t.Fatalf("Player wasn't told about hitting the totem. Events: %v", update.Events)
+		}
+		if !totemTile.HasTotem() && update.Events[0].Kind != TotemDestroyed {
+			t.Errorf("Player wasn't told they destroyed the totem. Events: %v", update.Events)
+		}
+	}
+	if len(engine.gameState.Totems()) != 0 {
+		t.Errorf("Destroyed totem is still in the state")
+	}
+}
+
+func TestTotemOnWall(t *testing.T) {
+	engine := NewEngine(20, 10, WithManualTicks())
+	pos := state.Coordinates{X: 5, Y: 5}
+	id, placer := addPlayerAt(t, engine, pos)
+	engine.standOnGround(placer, pos)
+	wall, _ := engine.gameState.GetTile(state.Coordinates{X: 5, Y: 4})
+	wall.SetHeight(placer.JumpHeight() + 1)
+	step, _ := engine.gameState.GetTile(state.Coordinates{X: 5, Y: 6})
+	step.SetHeight(placer.JumpHeight())
+
+	engine.SetAction(id, action.Set{Movement: pos, AttackDir: state.Up, PlaceTotem: 1})
+	engine.Step(1)
+	if wall.HasTotem() {
+		t.Errorf("Totem was placed on top of a wall")
+	}
+
+	// Anything they could jump up onto is fine
+	engine.SetAction(id, action.Set{Movement: pos, AttackDir: state.Down, PlaceTotem: 1})
+	engine.Step(1)
+	if !step.HasTotem() {
+		t.Errorf("Totem wasn't placed on a tile in reach")
+	}
+}
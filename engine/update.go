@@ -0,0 +1,55 @@
+package engine
+
+import (
+	"github.com/VivaLaPanda/antipath/entity"
+	"github.com/VivaLaPanda/antipath/entity/player"
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+// Update is what gets sent to a client each tick. Everything in it is a
+// copy, so it's safe to read while the engine carries on
+type Update struct {
+	// The client's own player
+	Player *player.Player
+	// The part of the world the client can see
+	State *state.State
+	// Everything that happened to the client's player since their last update
+	Events []Event
+	// The sequence number of the last of the player's inputs that's been
+	// applied. Clients can replay anything they sent after it on top of
+	// State to predict where they'll end up
+	LastInput uint64
+}
+
+// The kinds of thing that can happen to a player
+type EventKind string
+
+const (
+	// Attacker landed an attack on Victim
+	Hit EventKind = "hit"
+	// Victim died, at the hands of Attacker if there was one
+	Death EventKind = "death"
+	// Victim came back to life
+	Respawn EventKind = "respawn"
+	// Victim hit the ground hard enough to take Damage
+	Fall EventKind = "fall"
+	// Attacker damaged the totem at Pos
+	TotemHit EventKind = "totemHit"
+	// Attacker destroyed the totem at Pos
+	TotemDestroyed EventKind = "totemDestroyed"
+)
+
+// Something that happened to a player that they should be told about
+type Event struct {
+	Kind     EventKind          `json:"kind"`
+	Tick     uint64             `json:"tick"`
+	Attacker entity.ID          `json:"attacker,omitempty"`
+	Victim   entity.ID          `json:"victim,omitempty"`
+	Damage   uint               `json:"damage,omitempty"`
+	Pos      *state.Coordinates `json:"pos,omitempty"`
+}
+
+// Queues an event for a player's next update. Callers must hold tickLock
+func (e *Engine) notify(entityID entity.ID, event Event) {
+	e.events[entityID] = append(e.events[entityID], event)
+}
@@ -0,0 +1,39 @@
+package engine
+
+import (
+	"github.com/VivaLaPanda/antipath/engine/action"
+	"github.com/VivaLaPanda/antipath/entity/player"
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+// Creates the entities the map starts out with. They aren't recorded, as a
+// replay builds them from the map in the header.
+func (e *Engine) placeMapEntities() {
+	for _, mapEntity := range e.worldMap.Entities {
+		switch mapEntity.Kind {
+		case state.PlayerEntity:
+			newPlayer := player.NewPlayer()
+			entityID, _ := e.gameState.NewEntity(newPlayer, mapEntity.Pos)
+			e.standOnGround(newPlayer, mapEntity.Pos)
+			newPlayer.PlayerID = entityID
+			e.players[entityID] = newPlayer
+			e.playerActions[entityID] = e.newInputQueue(action.Set{Movement: mapEntity.Pos})
+		}
+	}
+}
+
+// Describes the world as it is right now as a map, including where every
+// living player is
+func (e *Engine) Map() *state.Map {
+	e.tickLock.Lock()
+	defer e.tickLock.Unlock()
+
+	worldMap := e.gameState.Map()
+	for _, id := range sortedIDs(e.players) {
+		if pos, exists := e.gameState.GetEntityPos(id); exists {
+			worldMap.Entities = append(worldMap.Entities, state.MapEntity{Kind: state.PlayerEntity, Pos: pos})
+		}
+	}
+
+	return worldMap
+}
@@ -6,4 +6,9 @@ type ID string
 type Entity interface {
 	Height() int
 	ID() ID
+	// A copy that stays put while the original carries on changing, so it
+	// can be handed to other goroutines
+	Copy() Entity
+	// Whether `other` is the same entity in the same state
+	Equal(other Entity) bool
 }
@@ -8,12 +8,15 @@ import (
 
 type Player struct {
 	PlayerID   entity.ID
+	Name       string
 	Health     uint
 	alignment  int
 	baseSpeed  int
 	height     int
 	jumpHeight int
 	Altitude   int
+	// The altitude they'd be at standing on whatever is under them
+	ground int
 }
 
 func NewPlayer() *Player {
@@ -24,6 +27,7 @@ func NewPlayer() *Player {
 		height:     5,
 		jumpHeight: 1,
 		Altitude:   1,
+		ground:     1,
 	}
 }
 
@@ -31,6 +35,7 @@ func (p *Player) MarshalJSON() ([]byte, error) {
 	return json.Marshal(&struct {
 		Health     uint      `json:"health"`
 		PlayerID   entity.ID `json:"playerID"`
+		Name       string    `json:"name,omitempty"`
 		Alignment  int       `json:"alignment"`
 		Speed      int       `json:"speed"`
 		Height     int       `json:"height"`
@@ -39,6 +44,7 @@ func (p *Player) MarshalJSON() ([]byte, error) {
 	}{
 		Health:     p.Health,
 		PlayerID:   p.PlayerID,
+		Name:       p.Name,
 		Alignment:  p.alignment,
 		Speed:      p.Speed(),
 		Height:     p.Height(),
@@ -51,25 +57,99 @@ func (p *Player) ID() entity.ID {
 	return p.PlayerID
 }
 
+func (p *Player) Copy() entity.Entity {
+	return p.Clone()
+}
+
+func (p *Player) Equal(other entity.Entity) bool {
+	otherPlayer, ok := other.(*Player)
+	return ok && *p == *otherPlayer
+}
+
+// Like Copy, but keeps the type
+func (p *Player) Clone() *Player {
+	copied := *p
+	return &copied
+}
+
 func (p *Player) Jump() {
 	// You can only jump if you'r already on the ground
-	if p.Altitude == 1 {
+	if p.Altitude == p.ground {
 		p.Altitude += p.jumpHeight
 	}
 }
 
 func (p *Player) Fall(speed int) {
-	if p.Altitude-speed > 1 {
+	if p.Altitude-speed > p.ground {
 		p.Altitude -= speed
 	} else {
-		p.Altitude = 1
+		p.Altitude = p.ground
 	}
 }
 
+// Tells the player what altitude the ground under them is at
+func (p *Player) SetGround(ground int) {
+	p.ground = ground
+}
+
+// The altitude they'd be at standing on the ground
+func (p *Player) Ground() int {
+	return p.ground
+}
+
+func (p *Player) Airborne() bool {
+	return p.Altitude > p.ground
+}
+
+// Takes `amount` off the player's health, bottoming out at 0
+func (p *Player) Damage(amount uint) {
+	if amount > p.Health {
+		p.Health = 0
+	} else {
+		p.Health -= amount
+	}
+}
+
+func (p *Player) Alignment() int {
+	return p.alignment
+}
+
+func (p *Player) SetAlignment(alignment int) {
+	p.alignment = alignment
+}
+
+// Moves the player's alignment up to `rate` towards `target`
+func (p *Player) DriftAlignment(target int, rate int) {
+	switch {
+	case target > p.alignment+rate:
+		p.alignment += rate
+	case target < p.alignment-rate:
+		p.alignment -= rate
+	default:
+		p.alignment = target
+	}
+}
+
+func (p *Player) Dead() bool {
+	return p.Health == 0
+}
+
+// Brings a dead player back with full health, standing on the ground
+func (p *Player) Respawn() {
+	fresh := NewPlayer()
+	p.Health = fresh.Health
+	p.Altitude = fresh.Altitude
+	p.ground = fresh.ground
+}
+
 func (p *Player) Height() int {
 	return p.height
 }
 
+func (p *Player) JumpHeight() int {
+	return p.jumpHeight
+}
+
 func (p *Player) Speed() int {
 	return p.baseSpeed
 }
@@ -32,3 +32,62 @@ func TestFall(t *testing.T) {
 		t.Errorf("Player didn't fall at the expected speed")
 	}
 }
+
+func TestDamage(t *testing.T) {
+	testPlayer := NewPlayer()
+
+	testPlayer.Damage(30)
+	if testPlayer.Health != 70 {
+		t.Errorf("Damage took off the wrong amount of health. A: %d, E: %d", testPlayer.Health, 70)
+	}
+
+	testPlayer.Damage(1000)
+	if testPlayer.Health != 0 {
+		t.Errorf("Damage past 0 health didn't stop at 0. A: %d", testPlayer.Health)
+	}
+}
+
+func TestRespawn(t *testing.T) {
+	testPlayer := NewPlayer()
+
+	testPlayer.Jump()
+	testPlayer.Damage(1000)
+	if !testPlayer.Dead() {
+		t.Errorf("Player with no health isn't dead")
+	}
+
+	testPlayer.Respawn()
+	if testPlayer.Dead() || testPlayer.Health != 100 || testPlayer.Altitude != 1 {
+		t.Errorf("Respawned player wasn't reset. %v", testPlayer)
+	}
+}
+
+func TestSetGround(t *testing.T) {
+	testPlayer := NewPlayer()
+
+	// Standing on a raised tile, so can still jump from there
+	testPlayer.SetGround(4)
+	testPlayer.Altitude = 4
+	testPlayer.Jump()
+	if !testPlayer.Airborne() || testPlayer.Altitude != 5 {
+		t.Errorf("Player couldn't jump from raised ground. Altitude: %d", testPlayer.Altitude)
+	}
+
+	testPlayer.Fall(10)
+	if testPlayer.Airborne() || testPlayer.Altitude != 4 {
+		t.Errorf("Player fell through the ground. Altitude: %d", testPlayer.Altitude)
+	}
+}
+
+func TestDriftAlignment(t *testing.T) {
+	testPlayer := NewPlayer()
+
+	testPlayer.DriftAlignment(10, 3)
+	if testPlayer.Alignment() != 3 {
+		t.Errorf("Alignment drifted the wrong amount. A: %d, E: %d", testPlayer.Alignment(), 3)
+	}
+	testPlayer.DriftAlignment(-10, 20)
+	if testPlayer.Alignment() != -10 {
+		t.Errorf("Alignment overshot its target. A: %d, E: %d", testPlayer.Alignment(), -10)
+	}
+}
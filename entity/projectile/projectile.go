@@ -1 +1,84 @@
 package projectile
+
+import (
+	"encoding/json"
+
+	"github.com/VivaLaPanda/antipath/entity"
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+// A projectile flies in a straight line at a fixed altitude until it hits
+// something or runs out of range
+type Projectile struct {
+	ProjectileID entity.ID
+	// Who fired it
+	Owner     entity.ID
+	Direction state.Direction
+	Altitude  int
+	// How many more ticks it flies for
+	TicksLeft int
+	speed     int
+	damage    uint
+}
+
+func NewProjectile(owner entity.ID, dir state.Direction, altitude int) *Projectile {
+	return &Projectile{
+		Owner:     owner,
+		Direction: dir,
+		Altitude:  altitude,
+		TicksLeft: 8,
+		speed:     2,
+		damage:    15,
+	}
+}
+
+func (p *Projectile) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&struct {
+		Kind         string          `json:"kind"`
+		ProjectileID entity.ID       `json:"projectileID"`
+		Owner        entity.ID       `json:"owner"`
+		Direction    state.Direction `json:"direction"`
+		Altitude     int             `json:"altitude"`
+		Height       int             `json:"height"`
+	}{
+		Kind:         "projectile",
+		ProjectileID: p.ProjectileID,
+		Owner:        p.Owner,
+		Direction:    p.Direction,
+		Altitude:     p.Altitude,
+		Height:       p.Height(),
+	})
+}
+
+func (p *Projectile) ID() entity.ID {
+	return p.ProjectileID
+}
+
+func (p *Projectile) Copy() entity.Entity {
+	copied := *p
+	return &copied
+}
+
+func (p *Projectile) Equal(other entity.Entity) bool {
+	otherProjectile, ok := other.(*Projectile)
+	return ok && *p == *otherProjectile
+}
+
+func (p *Projectile) Height() int {
+	return 1
+}
+
+// How many tiles it moves each tick
+func (p *Projectile) Speed() int {
+	return p.speed
+}
+
+func (p *Projectile) Damage() uint {
+	return p.damage
+}
+
+// Uses up one tick of flight time. Returns false once it's out of range
+func (p *Projectile) Fly() bool {
+	p.TicksLeft--
+	return p.TicksLeft > 0
+}
@@ -0,0 +1,28 @@
+package projectile
+
+import (
+	"testing"
+
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	testProjectile := NewProjectile("owner", state.Up, 2)
+
+	_, err := testProjectile.MarshalJSON()
+	if err != nil {
+		t.Errorf("Failed to marshal projectile struct into JSON, err: %v", err)
+	}
+}
+
+func TestFly(t *testing.T) {
+	testProjectile := NewProjectile("owner", state.Up, 2)
+
+	ticks := 1
+	for testProjectile.Fly() {
+		ticks++
+	}
+	if ticks != 8 {
+		t.Errorf("Projectile flew for the wrong number of ticks. A: %d, E: %d", ticks, 8)
+	}
+}
@@ -1,35 +1,199 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/VivaLaPanda/antipath/client"
+	"github.com/VivaLaPanda/antipath/client/auth"
 	"github.com/VivaLaPanda/antipath/engine"
+	"github.com/VivaLaPanda/antipath/engine/record"
+	"github.com/VivaLaPanda/antipath/state"
+	"github.com/VivaLaPanda/antipath/state/heightmap"
+	"github.com/VivaLaPanda/antipath/state/terrain"
 )
 
 var apiPort = flag.String("apiPort", "localhost:9095", "Which port to serve the API on")
+var tickRate = flag.Int("tickRate", engine.DefaultTickRate, "How many times per second the game state updates")
+var seed = flag.Int64("seed", 0, "Seed for the world's randomness. 0 picks one at random")
+var respawnDelay = flag.Duration("respawnDelay", engine.DefaultRespawnDelay, "How long dead players wait before respawning")
+var disconnectGrace = flag.Duration("disconnectGrace", 30*time.Second, "How long a disconnected player's body stays in the world, and so how long they have to reconnect")
+var terrainPreset = flag.String("terrain", "flat", "What kind of world to generate: flat, hills, dungeon or mixed")
+var mapPath = flag.String("map", "", "If set, start the world from this map file instead of generating terrain. PNGs are read as heightmaps")
+var recordPath = flag.String("record", "", "If set, record every action to this file so the game can be replayed")
+var snapshotPath = flag.String("snapshot", "", "If set, save the world to this file as it runs, and pick it back up from there on startup")
+var snapshotEvery = flag.Duration("snapshotEvery", time.Minute, "How often to save the world when -snapshot is set")
+var inputBuffer = flag.Int("inputBuffer", engine.DefaultInputBuffer, "How many inputs each player can have waiting before the oldest are dropped")
+var slowClientLimit = flag.Duration("slowClientLimit", 10*time.Second, "How long a client can go without keeping up with its updates before it's disconnected. 0 never disconnects them")
+var origins = flag.String("origins", "*", "Comma separated origins browsers may connect from, e.g. https://play.example.com. Defaults to any, since the web client is served from another origin. Set it to where your client is served from to lock it down, or to \"\" for only this host")
+var tokenFile = flag.String("tokenFile", "", "If set, players need one of the tokens listed in this file to connect")
+var authSecretFile = flag.String("authSecretFile", "", "If set, players need a token signed with the secret in this file to connect")
+var profilesPath = flag.String("profiles", "", "Where to keep signed in players' profiles. By default they're forgotten on restart")
+
+// How many bots wander the world when it starts fresh
+const botCount = 30
+
+// How long we give clients to disconnect before we stop waiting on them
+const shutdownTimeout = 5 * time.Second
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		replay(os.Args[2:])
+		return
+	}
 	flag.Parse()
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// http.HandleFunc("/", serveHome)
-	engine := engine.NewEngine(100, 40)
-	for idx := 0; idx < 30; idx++ {
-		engine.AddPlayer()
+	options := []engine.Option{
+		engine.WithTickRate(*tickRate),
+		engine.WithRespawnDelay(*respawnDelay),
+		engine.WithDisconnectGrace(*disconnectGrace),
+		engine.WithInputBuffer(*inputBuffer, engine.DropOldest),
+		engine.WithSlowClientLimit(*slowClientLimit),
 	}
-	http.HandleFunc("/server", func(w http.ResponseWriter, r *http.Request) {
-		client.ServeWs(engine, w, r)
-	})
+	if *seed != 0 {
+		options = append(options, engine.WithSeed(*seed))
+	}
+	bots := botCount
+	if *mapPath != "" {
+		var worldMap *state.Map
+		var err error
+		if filepath.Ext(*mapPath) == ".png" {
+			worldMap, err = heightmap.LoadMap(*mapPath, heightmap.Options{})
+		} else {
+			worldMap, err = state.LoadMap(*mapPath)
+		}
+		if err != nil {
+			log.Fatalf("Couldn't load map: %v", err)
+		}
+		// Don't crowd bots in anywhere the map didn't mean players to start
+		if len(worldMap.Spawns) > 0 && worldMap.FreeSpawns() < bots {
+			bots = worldMap.FreeSpawns()
+			log.Printf("Map only has %d free spawn points, adding that many bots", bots)
+		}
+		options = append(options, engine.WithMap(worldMap))
+	} else {
+		terrainParams, err := terrain.Preset(*terrainPreset)
+		if err != nil {
+			log.Fatal(err)
+		}
+		options = append(options, engine.WithTerrain(terrainParams))
+	}
+	restored := false
+	if *snapshotPath != "" {
+		options = append(options, engine.WithSnapshots(*snapshotPath, *snapshotEvery))
+		snapshot, err := engine.LoadSnapshot(*snapshotPath)
+		switch {
+		case err == nil:
+			log.Printf("Restoring world from tick %d", snapshot.Tick)
+			options = append(options, engine.WithSnapshot(snapshot))
+			restored = true
+		case !os.IsNotExist(err):
+			log.Fatalf("Couldn't load snapshot: %v", err)
+		}
+	}
+	if *recordPath != "" {
+		recorder, err := record.Create(*recordPath)
+		if err != nil {
+			log.Fatalf("Couldn't create recording: %v", err)
+		}
+		defer recorder.Close()
+		options = append(options, engine.WithRecorder(recorder))
+	}
+	engine := engine.NewEngine(100, 40, options...)
+	log.Printf("World seed: %d", engine.Seed())
+	if !restored {
+		// The bots from last time came back with the rest of the world
+		for idx := 0; idx < bots; idx++ {
+			if _, err := engine.AddPlayer(); err != nil {
+				log.Printf("Only had room for %d bots: %v", idx, err)
+				break
+			}
+		}
+	}
+	engine.Start(ctx)
+
+	http.Handle("/server", client.NewServer(engine, serverOptions()...))
 	http.HandleFunc("/windowsize", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Write([]byte(strconv.Itoa(engine.WindowSize)))
 		return
 	})
-	err := http.ListenAndServe(*apiPort, nil)
+	server := &http.Server{Addr: *apiPort}
+	go func() {
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal("ListenAndServe: ", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down...")
+
+	// Stop taking new connections, then stop the simulation which tells every
+	// connected client to hang up
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("HTTP server didn't shut down cleanly: %v", err)
+	}
+	engine.Stop()
+	inputs := engine.TotalInputStats()
+	log.Printf("Applied %d inputs, dropped %d (%d overflowed, %d stale, %d replaced, %d abandoned)",
+		inputs.Applied, inputs.Dropped(), inputs.Overflowed, inputs.Stale, inputs.Replaced, inputs.Abandoned)
+	sends := engine.TotalClientStats()
+	log.Printf("Queued %d updates for clients, skipped %d, disconnected %d slow clients",
+		sends.Queued, sends.Skipped, sends.TooSlow)
+	if err := client.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Clients didn't disconnect in time: %v", err)
+	}
+}
+
+// Works out who's allowed to connect from the flags
+func serverOptions() []client.ServerOption {
+	options := []client.ServerOption{}
+	if *origins != "" {
+		options = append(options, client.WithOrigins(strings.Split(*origins, ",")...))
+	}
+
+	authenticators := auth.Chain{}
+	if *tokenFile != "" {
+		tokens, err := auth.LoadTokenFile(*tokenFile)
+		if err != nil {
+			log.Fatalf("Couldn't load token file: %v", err)
+		}
+		authenticators = append(authenticators, tokens)
+	}
+	if *authSecretFile != "" {
+		secret, err := os.ReadFile(*authSecretFile)
+		if err != nil {
+			log.Fatalf("Couldn't read auth secret: %v", err)
+		}
+		secret = []byte(strings.TrimSpace(string(secret)))
+		if len(secret) < 32 {
+			log.Fatalf("Auth secret is too short, it needs at least 32 bytes")
+		}
+		authenticators = append(authenticators, auth.NewHMAC(secret))
+	}
+	if len(authenticators) == 0 {
+		return options
+	}
+
+	profiles, err := auth.OpenProfiles(*profilesPath)
 	if err != nil {
-		log.Fatal("ListenAndServe: ", err)
+		log.Fatalf("Couldn't load profiles: %v", err)
 	}
+	return append(options, client.WithAuthenticator(authenticators), client.WithProfiles(profiles))
 }
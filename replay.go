@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/VivaLaPanda/antipath/engine"
+	"github.com/VivaLaPanda/antipath/engine/record"
+	"github.com/VivaLaPanda/antipath/state/heightmap"
+)
+
+// Runs a recording made with -record back through the engine and writes out
+// the resulting game state as JSON.
+//
+// Usage: antipath replay [-tick N] [-out state.json] [-png world.png] game.rec
+func replay(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	tick := flags.Uint64("tick", 0, "Tick to stop at. 0 replays the whole recording")
+	outPath := flags.String("out", "", "Where to write the state. Defaults to stdout")
+	pngPath := flags.String("png", "", "If set, also draw the world as a heightmap to this file")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		log.Fatal("usage: antipath replay [-tick N] [-out state.json] [-png world.png] game.rec")
+	}
+	logPath := flags.Arg(0)
+
+	if *tick == 0 {
+		*tick = lastTick(logPath)
+	}
+
+	reader, err := record.Open(logPath)
+	if err != nil {
+		log.Fatalf("Couldn't open recording: %v", err)
+	}
+	defer reader.Close()
+
+	replayed, err := engine.Replay(reader, *tick)
+	if err != nil {
+		log.Fatalf("Replay failed: %v", err)
+	}
+
+	stateJSON, err := replayed.State().MarshalJSON()
+	if err != nil {
+		log.Fatalf("Couldn't encode state: %v", err)
+	}
+
+	out := os.Stdout
+	if *outPath != "" {
+		out, err = os.Create(*outPath)
+		if err != nil {
+			log.Fatalf("Couldn't create output file: %v", err)
+		}
+		defer out.Close()
+	}
+	out.Write(stateJSON)
+
+	if *pngPath != "" {
+		pngFile, err := os.Create(*pngPath)
+		if err != nil {
+			log.Fatalf("Couldn't create heightmap file: %v", err)
+		}
+		defer pngFile.Close()
+		if err := heightmap.Export(pngFile, replayed.State(), heightmap.Options{}); err != nil {
+			log.Fatalf("Couldn't draw heightmap: %v", err)
+		}
+	}
+	log.Printf("Replayed to tick %d", replayed.Tick())
+}
+
+// Finds the tick of the last event in a recording
+func lastTick(logPath string) (tick uint64) {
+	reader, err := record.Open(logPath)
+	if err != nil {
+		log.Fatalf("Couldn't open recording: %v", err)
+	}
+	defer reader.Close()
+
+	for {
+		event, err := reader.Next()
+		if err == io.EOF {
+			return tick
+		}
+		if err != nil {
+			log.Fatalf("Couldn't read recording: %v", err)
+		}
+		tick = event.Tick
+	}
+}
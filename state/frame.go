@@ -0,0 +1,70 @@
+package state
+
+import (
+	"github.com/VivaLaPanda/antipath/entity"
+	"github.com/VivaLaPanda/antipath/state/tile"
+)
+
+// A frozen copy of the whole world at one tick, which PeekState cuts windows
+// out of. Frames never change once they're made, so a row that hasn't changed
+// is shared from one frame to the next instead of being copied again.
+type frame struct {
+	tick     uint64
+	rows     [][]tile.Tile
+	entities map[entity.ID]Coordinates
+}
+
+// Takes a frame of the world as it is now for PeekState to hand out. Only rows
+// that have changed since the last frame are copied. Rows with entities on
+// them are always copied, since entities can change without the grid
+// knowing about it.
+//
+// PeekState freezes the state itself once the tick moves on or the grid
+// changes, so this only needs calling to pick up changes made to entities
+// mid tick.
+func (s *State) Freeze() {
+	entities := s.Entities()
+	occupied := make(map[int]bool, len(entities))
+	for _, pos := range entities {
+		occupied[pos.Y] = true
+	}
+
+	rows := make([][]tile.Tile, s.size)
+	for y := range rows {
+		if s.frame != nil && !s.dirty[y] && !occupied[y] {
+			rows[y] = s.frame.rows[y]
+			continue
+		}
+
+		row := make([]tile.Tile, s.size)
+		for x := range row {
+			row[x] = s.grid[y][x].Copy()
+		}
+		rows[y] = row
+		s.dirty[y] = false
+	}
+
+	s.frame = &frame{tick: s.Tick(), rows: rows, entities: entities}
+	s.frameStale = false
+}
+
+// Notes that row `y` has changed since the last frame. Snapshots from
+// PeekState never change, so there's nothing to note for them
+func (s *State) markDirty(y int) {
+	if s.dirty == nil {
+		return
+	}
+
+	s.dirty[y] = true
+	s.frameStale = true
+}
+
+// The frame to cut snapshots from, freezing a new one if the last is out of
+// date
+func (s *State) currentFrame() *frame {
+	if s.frame == nil || s.frameStale || s.frame.tick != s.Tick() {
+		s.Freeze()
+	}
+
+	return s.frame
+}
@@ -0,0 +1,83 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/VivaLaPanda/antipath/entity/player"
+)
+
+func TestFrameSharing(t *testing.T) {
+	testState := NewState(20)
+	testPlayer := player.NewPlayer()
+	playerID, _ := testState.NewEntity(testPlayer, Coordinates{10, 10})
+	before := testState.PeekStateAt(Coordinates{10, 10}, 20)
+
+	changed, _ := testState.GetTile(Coordinates{3, 3})
+	changed.SetHeight(4)
+	testPlayer.Damage(30)
+	testState.AdvanceTick()
+	after := testState.PeekStateAt(Coordinates{10, 10}, 20)
+
+	// Untouched rows are shared, changed ones and ones with entities aren't
+	if &before.grid[5][0] != &after.grid[5][0] {
+		t.Errorf("Unchanged row was copied")
+	}
+	if &before.grid[3][0] == &after.grid[3][0] || &before.grid[10][0] == &after.grid[10][0] {
+		t.Errorf("Changed row was shared")
+	}
+
+	// Each snapshot shows the world as it was when it was taken
+	if before.grid[3][3].TerrainHeight() != 0 || after.grid[3][3].TerrainHeight() != 4 {
+		t.Errorf("Snapshots show the wrong heights. Before: %d, After: %d", before.grid[3][3].TerrainHeight(), after.grid[3][3].TerrainHeight())
+	}
+	beforePlayer := before.grid[10][10].PeekEntity().(*player.Player)
+	afterPlayer := after.grid[10][10].PeekEntity().(*player.Player)
+	if beforePlayer.Health != 100 || afterPlayer.Health != 70 {
+		t.Errorf("Snapshots show the wrong health. Before: %d, After: %d", beforePlayer.Health, afterPlayer.Health)
+	}
+	if before.Tick() != 0 || after.Tick() != 1 {
+		t.Errorf("Snapshots have the wrong ticks. Before: %d, After: %d", before.Tick(), after.Tick())
+	}
+
+	// Moving within a tick still shows up, since it goes through the grid
+	testState.ChangePos(playerID, Coordinates{10, 12}, testPlayer.Altitude)
+	moved := testState.PeekStateAt(Coordinates{10, 10}, 20)
+	if moved.entities[playerID] != (Coordinates{10, 12}) || moved.grid[10][10].PeekEntity() != nil {
+		t.Errorf("Snapshot missed a move. A: %v, E: %v", moved.entities[playerID], Coordinates{10, 12})
+	}
+	if after.entities[playerID] != (Coordinates{10, 10}) {
+		t.Errorf("Earlier snapshot saw a later move. A: %v", after.entities[playerID])
+	}
+}
+
+func TestPeekingDoesntDirty(t *testing.T) {
+	testState := NewState(20)
+	testState.Freeze()
+
+	testState.PeekTile(Coordinates{3, 3})
+	// Nothing to damage, so nothing changes
+	testState.DamageTotem(Coordinates{3, 3}, 10)
+	if testState.frameStale {
+		t.Errorf("Looking at tiles made the frame stale")
+	}
+}
+
+// A tick's worth of updates for a busy server
+func BenchmarkPeekState(b *testing.B) {
+	testState := NewState(100)
+	positions := []Coordinates{}
+	for idx := 0; idx < 300; idx++ {
+		pos := Coordinates{idx % 100, (idx * 7) % 100}
+		if _, err := testState.NewEntity(player.NewPlayer(), pos); err == nil {
+			positions = append(positions, pos)
+		}
+	}
+
+	for n := 0; n < b.N; n++ {
+		testState.AdvanceTick()
+		testState.Freeze()
+		for _, pos := range positions {
+			testState.PeekStateAt(pos, 40)
+		}
+	}
+}
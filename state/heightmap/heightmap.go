@@ -0,0 +1,159 @@
+// Package heightmap converts between worlds and PNG images, so maps can be
+// painted in an image editor.
+//
+// Each pixel is one tile. The green channel is the tile's height, so a plain
+// grayscale image is just a heightmap. Red and blue paint alignment: the
+// difference between them is scaled to the alignment range, with red
+// positive and blue negative. Any pixel that isn't fully opaque gets a totem,
+// aligned the same way as its tile.
+package heightmap
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+
+	"github.com/VivaLaPanda/antipath/state"
+	"github.com/VivaLaPanda/antipath/state/tile"
+)
+
+// Height of a full brightness pixel if Options doesn't say otherwise. Just
+// high enough that a white pixel makes a wall nobody can jump.
+const DefaultMaxHeight = 25
+
+type Options struct {
+	// The height a full brightness pixel turns into, darker pixels are scaled
+	// down from it
+	MaxHeight int
+}
+
+func (opts Options) maxHeight() int {
+	if opts.MaxHeight < 1 {
+		return DefaultMaxHeight
+	}
+
+	return opts.MaxHeight
+}
+
+// Turns a PNG into a map. The image has to be square.
+func Decode(r io.Reader, opts Options) (*state.Map, error) {
+	img, err := png.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't decode heightmap, err: %s", err)
+	}
+	bounds := img.Bounds()
+	if bounds.Dx() != bounds.Dy() {
+		return nil, fmt.Errorf("heightmap must be square, got %dx%d", bounds.Dx(), bounds.Dy())
+	}
+
+	size := bounds.Dx()
+	m := &state.Map{Size: size, Heights: make([][]int, size), Alignment: make([][]int, size)}
+	for y := 0; y < size; y++ {
+		m.Heights[y] = make([]int, size)
+		m.Alignment[y] = make([]int, size)
+		for x := 0; x < size; x++ {
+			// Non premultiplied, so translucent totem pixels keep their colour
+			pixel := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			m.Heights[y][x] = scale(int(pixel.G), 255, opts.maxHeight())
+			m.Alignment[y][x] = scale(int(pixel.R)-int(pixel.B), 255, tile.MaxAlignment)
+
+			if pixel.A < 255 {
+				m.Totems = append(m.Totems, state.MapTotem{
+					Pos:       state.Coordinates{X: x, Y: y},
+					Alignment: m.Alignment[y][x],
+				})
+			}
+		}
+	}
+
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Draws a map as a PNG the same way Decode reads one. Heights above
+// MaxHeight are drawn at full brightness.
+func Encode(w io.Writer, m *state.Map, opts Options) error {
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	totems := make(map[state.Coordinates]bool)
+	for _, totem := range m.Totems {
+		totems[totem.Pos] = true
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, m.Size, m.Size))
+	for y := 0; y < m.Size; y++ {
+		for x := 0; x < m.Size; x++ {
+			pixel := color.NRGBA{A: 255}
+			pixel.G = uint8(clamp(scale(m.Heights[y][x], opts.maxHeight(), 255), 0, 255))
+			if m.Alignment != nil {
+				alignment := scale(m.Alignment[y][x], tile.MaxAlignment, 255)
+				if alignment > 0 {
+					pixel.R = uint8(alignment)
+				} else {
+					pixel.B = uint8(-alignment)
+				}
+			}
+			if totems[state.Coordinates{X: x, Y: y}] {
+				pixel.A = 128
+			}
+			img.SetNRGBA(x, y, pixel)
+		}
+	}
+
+	return png.Encode(w, img)
+}
+
+// Builds a state straight from a PNG
+func Import(r io.Reader, seed int64, opts Options) (*state.State, error) {
+	m, err := Decode(r, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return state.NewStateFromMap(m, seed)
+}
+
+// Draws a state's terrain as a PNG
+func Export(w io.Writer, s *state.State, opts Options) error {
+	return Encode(w, s.Map(), opts)
+}
+
+// Loads a map from a PNG file
+func LoadMap(path string, opts Options) (*state.Map, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Decode(file, opts)
+}
+
+// Rescales `value` from the range 0-`from` to 0-`to`, rounding to nearest
+func scale(value int, from int, to int) int {
+	scaled := value * to
+	if scaled < 0 {
+		return -((-scaled + from/2) / from)
+	}
+
+	return (scaled + from/2) / from
+}
+
+func clamp(a int, min int, max int) int {
+	if a < min {
+		return min
+	}
+	if a > max {
+		return max
+	}
+
+	return a
+}
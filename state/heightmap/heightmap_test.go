@@ -0,0 +1,70 @@
+package heightmap
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"reflect"
+	"testing"
+
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+func TestDecodeGray(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 3, 3))
+	img.SetGray(1, 2, color.Gray{Y: 255})
+	img.SetGray(2, 0, color.Gray{Y: 51})
+	buf := &bytes.Buffer{}
+	png.Encode(buf, img)
+
+	m, err := Decode(buf, Options{MaxHeight: 10})
+	if err != nil {
+		t.Fatalf("Failed to decode grayscale heightmap, err: %v", err)
+	}
+	if m.Heights[2][1] != 10 || m.Heights[0][2] != 2 || m.Heights[0][0] != 0 {
+		t.Errorf("Brightness wasn't turned into height. A: %v", m.Heights)
+	}
+	if len(m.Totems) != 0 {
+		t.Errorf("Opaque grayscale image has totems. A: %v", m.Totems)
+	}
+	for _, row := range m.Alignment {
+		for _, alignment := range row {
+			if alignment != 0 {
+				t.Errorf("Grayscale image has alignment. A: %v", m.Alignment)
+			}
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	s := state.NewState(8)
+	ground, _ := s.GetTile(state.Coordinates{X: 3, Y: 4})
+	ground.SetHeight(5)
+	reddish, _ := s.GetTile(state.Coordinates{X: 6, Y: 1})
+	reddish.SetAlignment(40)
+	s.PlaceTotem(state.Coordinates{X: 2, Y: 2}, -100)
+	original := s.Map()
+
+	buf := &bytes.Buffer{}
+	if err := Export(buf, s, Options{}); err != nil {
+		t.Fatalf("Failed to export heightmap, err: %v", err)
+	}
+	loaded, err := Import(buf, 1, Options{})
+	if err != nil {
+		t.Fatalf("Failed to import heightmap, err: %v", err)
+	}
+
+	if !reflect.DeepEqual(loaded.Map(), original) {
+		t.Errorf("World changed on the way through a PNG. A: %v, E: %v", loaded.Map(), original)
+	}
+}
+
+func TestDecodeNotSquare(t *testing.T) {
+	buf := &bytes.Buffer{}
+	png.Encode(buf, image.NewGray(image.Rect(0, 0, 4, 3)))
+
+	if _, err := Decode(buf, Options{}); err == nil {
+		t.Errorf("Decoding a non square image didn't produce an error")
+	}
+}
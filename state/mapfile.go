@@ -0,0 +1,435 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/VivaLaPanda/antipath/state/tile"
+)
+
+// The kinds of entity a map can start out with
+const (
+	PlayerEntity = "player"
+)
+
+var mapEntityKinds = map[string]bool{
+	PlayerEntity: true,
+}
+
+// Biggest map we'll load, so a bad file can't make us allocate forever
+const maxMapSize = 4096
+
+// Every binary map file starts with this
+var binaryMapMagic = []byte("APMAP\x01")
+
+// Map is the on-disk description of a world. It can be saved as JSON for
+// editing by hand, or in a compact binary form.
+type Map struct {
+	Size int `json:"size"`
+	// Indexed [y][x], like the state grid
+	Heights [][]int `json:"heights"`
+	// Optional, everything starts neutral if it's left out
+	Alignment [][]int       `json:"alignment,omitempty"`
+	Totems    []MapTotem    `json:"totems,omitempty"`
+	Spawns    []Coordinates `json:"spawns,omitempty"`
+	Entities  []MapEntity   `json:"entities,omitempty"`
+}
+
+type MapTotem struct {
+	Pos       Coordinates `json:"pos"`
+	Alignment int         `json:"alignment"`
+	// 0 means full health
+	Health int `json:"health,omitempty"`
+}
+
+// Something that's in the world from the start
+type MapEntity struct {
+	Kind string      `json:"kind"`
+	Pos  Coordinates `json:"pos"`
+}
+
+// TileError is a problem with one particular tile of a map
+type TileError struct {
+	Pos Coordinates
+	Msg string
+}
+
+func (err *TileError) Error() string {
+	return fmt.Sprintf("tile %v: %s", err.Pos, err.Msg)
+}
+
+// Checks the map describes a world that makes sense. Problems with a specific
+// tile come back as a *TileError.
+func (m *Map) Validate() error {
+	if m.Size < 1 || m.Size > maxMapSize {
+		return fmt.Errorf("map size must be between 1 and %d, got %d", maxMapSize, m.Size)
+	}
+	if err := checkLayer("heights", m.Heights, m.Size); err != nil {
+		return err
+	}
+	if m.Alignment != nil {
+		if err := checkLayer("alignment", m.Alignment, m.Size); err != nil {
+			return err
+		}
+	}
+
+	for y := 0; y < m.Size; y++ {
+		for x := 0; x < m.Size; x++ {
+			if m.Heights[y][x] < 0 {
+				return &TileError{Coordinates{x, y}, fmt.Sprintf("height %d is negative", m.Heights[y][x])}
+			}
+			if m.Alignment != nil && abs(m.Alignment[y][x]) > tile.MaxAlignment {
+				return &TileError{Coordinates{x, y}, fmt.Sprintf("alignment %d is beyond +-%d", m.Alignment[y][x], tile.MaxAlignment)}
+			}
+		}
+	}
+
+	totems := make(map[Coordinates]bool)
+	for _, totem := range m.Totems {
+		if outOfBounds(m.Size, totem.Pos) {
+			return &TileError{totem.Pos, "totem is off the map"}
+		}
+		if totems[totem.Pos] {
+			return &TileError{totem.Pos, "more than one totem"}
+		}
+		if totem.Health < 0 || totem.Health > tile.MaxTotemHealth {
+			return &TileError{totem.Pos, fmt.Sprintf("totem health %d is outside 0-%d", totem.Health, tile.MaxTotemHealth)}
+		}
+		if abs(totem.Alignment) > tile.MaxAlignment {
+			return &TileError{totem.Pos, fmt.Sprintf("totem alignment %d is beyond +-%d", totem.Alignment, tile.MaxAlignment)}
+		}
+		totems[totem.Pos] = true
+	}
+
+	for _, spawn := range m.Spawns {
+		if outOfBounds(m.Size, spawn) {
+			return &TileError{spawn, "spawn point is off the map"}
+		}
+	}
+
+	occupied := make(map[Coordinates]bool)
+	for _, mapEntity := range m.Entities {
+		if outOfBounds(m.Size, mapEntity.Pos) {
+			return &TileError{mapEntity.Pos, "entity is off the map"}
+		}
+		if occupied[mapEntity.Pos] {
+			return &TileError{mapEntity.Pos, "more than one entity"}
+		}
+		if !mapEntityKinds[mapEntity.Kind] {
+			return &TileError{mapEntity.Pos, fmt.Sprintf("unknown entity kind %q", mapEntity.Kind)}
+		}
+		occupied[mapEntity.Pos] = true
+	}
+
+	return nil
+}
+
+// How many different spawn points the map has with nothing starting out on
+// them, so how many players can join before spawning gets crowded
+func (m *Map) FreeSpawns() int {
+	occupied := make(map[Coordinates]bool)
+	for _, mapEntity := range m.Entities {
+		occupied[mapEntity.Pos] = true
+	}
+
+	free := 0
+	for _, spawn := range m.Spawns {
+		if !occupied[spawn] {
+			occupied[spawn] = true
+			free++
+		}
+	}
+
+	return free
+}
+
+// Makes sure a per-tile layer is square and the same size as the map
+func checkLayer(name string, layer [][]int, size int) error {
+	if len(layer) != size {
+		return fmt.Errorf("%s has %d rows, expected %d", name, len(layer), size)
+	}
+	for y, row := range layer {
+		if len(row) != size {
+			return fmt.Errorf("%s row %d has %d tiles, expected %d", name, y, len(row), size)
+		}
+	}
+
+	return nil
+}
+
+// Builds a state from a map. Entities aren't placed, as the state doesn't
+// know how to make them, that's up to whoever is running the world.
+func NewStateFromMap(m *Map, seed int64) (*State, error) {
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := NewSeededState(m.Size, seed)
+	for y := 0; y < m.Size; y++ {
+		for x := 0; x < m.Size; x++ {
+			s.grid[y][x].SetHeight(m.Heights[y][x])
+			if m.Alignment != nil {
+				s.grid[y][x].SetAlignment(m.Alignment[y][x])
+			}
+		}
+	}
+	for _, totem := range m.Totems {
+		s.PlaceTotem(totem.Pos, totem.Alignment)
+		if totem.Health > 0 {
+			s.DamageTotem(totem.Pos, tile.MaxTotemHealth-totem.Health)
+		}
+	}
+	s.SetSpawnPoints(append([]Coordinates(nil), m.Spawns...))
+
+	return s, nil
+}
+
+// Describes the state's terrain as a map. Entities are left out, since the
+// state doesn't know what kind of thing they are.
+func (s *State) Map() *Map {
+	m := &Map{
+		Size:      s.size,
+		Heights:   make([][]int, s.size),
+		Alignment: make([][]int, s.size),
+		Spawns:    append([]Coordinates(nil), s.spawnPoints...),
+	}
+	for y := 0; y < s.size; y++ {
+		m.Heights[y] = make([]int, s.size)
+		m.Alignment[y] = make([]int, s.size)
+		for x := 0; x < s.size; x++ {
+			m.Heights[y][x] = s.grid[y][x].TerrainHeight()
+			m.Alignment[y][x] = s.grid[y][x].Alignment()
+		}
+	}
+	for _, pos := range s.Totems() {
+		totemTile := &s.grid[pos.Y][pos.X]
+		m.Totems = append(m.Totems, MapTotem{Pos: pos, Alignment: totemTile.Alignment(), Health: totemTile.TotemHealth()})
+	}
+
+	return m
+}
+
+// Reads a map in either format, working out which from the contents
+func ReadMap(r io.Reader) (*Map, error) {
+	buf := bufio.NewReader(r)
+	start, _ := buf.Peek(len(binaryMapMagic))
+	if bytes.Equal(start, binaryMapMagic) {
+		return readBinaryMap(buf)
+	}
+
+	m := &Map{}
+	if err := json.NewDecoder(buf).Decode(m); err != nil {
+		return nil, fmt.Errorf("couldn't parse map JSON, err: %s", err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+func (m *Map) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(m)
+}
+
+// Writes the map in the compact binary format. Every number is a varint, so
+// a typical map of small heights takes about a byte per tile.
+func (m *Map) WriteBinary(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	out := &binaryMapWriter{w: buf}
+
+	buf.Write(binaryMapMagic)
+	out.uint(m.Size)
+	for _, row := range m.Heights {
+		for _, height := range row {
+			out.int(height)
+		}
+	}
+	if m.Alignment != nil {
+		out.uint(1)
+		for _, row := range m.Alignment {
+			for _, alignment := range row {
+				out.int(alignment)
+			}
+		}
+	} else {
+		out.uint(0)
+	}
+
+	out.uint(len(m.Totems))
+	for _, totem := range m.Totems {
+		out.pos(totem.Pos)
+		out.int(totem.Alignment)
+		out.int(totem.Health)
+	}
+	out.uint(len(m.Spawns))
+	for _, spawn := range m.Spawns {
+		out.pos(spawn)
+	}
+	out.uint(len(m.Entities))
+	for _, mapEntity := range m.Entities {
+		out.uint(len(mapEntity.Kind))
+		buf.WriteString(mapEntity.Kind)
+		out.pos(mapEntity.Pos)
+	}
+
+	return buf.Flush()
+}
+
+// Loads a map from a file in either format
+func LoadMap(path string) (*Map, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ReadMap(file)
+}
+
+// Saves a map to a file. Files ending in .json are written as JSON,
+// everything else in the binary format.
+func SaveMap(path string, m *Map) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if filepath.Ext(path) == ".json" {
+		err = m.WriteJSON(file)
+	} else {
+		err = m.WriteBinary(file)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// Loads a map file and builds a state from it
+func LoadState(path string, seed int64) (*State, error) {
+	m, err := LoadMap(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewStateFromMap(m, seed)
+}
+
+// Saves the state's terrain to a map file
+func SaveState(path string, s *State) error {
+	return SaveMap(path, s.Map())
+}
+
+type binaryMapWriter struct {
+	w       *bufio.Writer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (out *binaryMapWriter) uint(value int) {
+	n := binary.PutUvarint(out.scratch[:], uint64(value))
+	out.w.Write(out.scratch[:n])
+}
+
+func (out *binaryMapWriter) int(value int) {
+	n := binary.PutVarint(out.scratch[:], int64(value))
+	out.w.Write(out.scratch[:n])
+}
+
+func (out *binaryMapWriter) pos(pos Coordinates) {
+	out.int(pos.X)
+	out.int(pos.Y)
+}
+
+// Reads the binary format. Any read error sticks, so the parsing code can read
+// everything and only check once at the end.
+type binaryMapReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (in *binaryMapReader) uint(max int) int {
+	if in.err != nil {
+		return 0
+	}
+	value, err := binary.ReadUvarint(in.r)
+	if err == nil && value > uint64(max) {
+		err = fmt.Errorf("value %d is bigger than the limit of %d", value, max)
+	}
+	in.err = err
+
+	return int(value)
+}
+
+func (in *binaryMapReader) int() int {
+	if in.err != nil {
+		return 0
+	}
+	value, err := binary.ReadVarint(in.r)
+	in.err = err
+
+	return int(value)
+}
+
+func (in *binaryMapReader) pos() Coordinates {
+	return Coordinates{X: in.int(), Y: in.int()}
+}
+
+func readBinaryMap(r *bufio.Reader) (*Map, error) {
+	if _, err := r.Discard(len(binaryMapMagic)); err != nil {
+		return nil, err
+	}
+	in := &binaryMapReader{r: r}
+	m := &Map{}
+
+	m.Size = in.uint(maxMapSize)
+	readLayer := func() [][]int {
+		layer := make([][]int, m.Size)
+		for y := range layer {
+			layer[y] = make([]int, m.Size)
+			for x := range layer[y] {
+				layer[y][x] = in.int()
+			}
+		}
+		return layer
+	}
+	m.Heights = readLayer()
+	if hasAlignment := in.uint(1); hasAlignment == 1 {
+		m.Alignment = readLayer()
+	}
+
+	// Nothing can have more than one of these per tile
+	maxPerTile := m.Size * m.Size
+	m.Totems = make([]MapTotem, in.uint(maxPerTile))
+	for idx := range m.Totems {
+		m.Totems[idx] = MapTotem{Pos: in.pos(), Alignment: in.int(), Health: in.int()}
+	}
+	m.Spawns = make([]Coordinates, in.uint(maxPerTile))
+	for idx := range m.Spawns {
+		m.Spawns[idx] = in.pos()
+	}
+	m.Entities = make([]MapEntity, in.uint(maxPerTile))
+	for idx := range m.Entities {
+		kind := make([]byte, in.uint(64))
+		if in.err == nil {
+			_, in.err = io.ReadFull(r, kind)
+		}
+		m.Entities[idx] = MapEntity{Kind: string(kind), Pos: in.pos()}
+	}
+
+	if in.err != nil {
+		return nil, fmt.Errorf("couldn't parse binary map, err: %s", in.err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
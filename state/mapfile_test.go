@@ -0,0 +1,85 @@
+package state
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func testMap() *Map {
+	m := &Map{Size: 4, Heights: make([][]int, 4), Alignment: make([][]int, 4)}
+	for y := range m.Heights {
+		m.Heights[y] = []int{0, 1, 2, y}
+		m.Alignment[y] = []int{-100, 0, 50, y}
+	}
+	// Totems pin their own tile
+	m.Alignment[1][1] = 80
+	m.Totems = []MapTotem{{Pos: Coordinates{1, 1}, Alignment: 80, Health: 40}}
+	m.Spawns = []Coordinates{{0, 0}, {3, 3}}
+	m.Entities = []MapEntity{{Kind: PlayerEntity, Pos: Coordinates{2, 2}}}
+
+	return m
+}
+
+func TestMapRoundTrip(t *testing.T) {
+	original := testMap()
+
+	for _, format := range []string{"json", "binary"} {
+		buf := &bytes.Buffer{}
+		if format == "json" {
+			original.WriteJSON(buf)
+		} else {
+			original.WriteBinary(buf)
+		}
+
+		loaded, err := ReadMap(buf)
+		if err != nil {
+			t.Fatalf("Failed to read %s map, err: %v", format, err)
+		}
+		if !reflect.DeepEqual(loaded, original) {
+			t.Errorf("%s map changed on the way through. A: %v, E: %v", format, loaded, original)
+		}
+	}
+}
+
+func TestStateFromMap(t *testing.T) {
+	original := testMap()
+	s, err := NewStateFromMap(original, 1)
+	if err != nil {
+		t.Fatalf("Failed to build state from map, err: %v", err)
+	}
+
+	totemTile, _ := s.GetTile(Coordinates{1, 1})
+	if !totemTile.HasTotem() || totemTile.TotemHealth() != 40 {
+		t.Errorf("Totem wasn't placed with its health. A: %d, E: %d", totemTile.TotemHealth(), 40)
+	}
+
+	// The state doesn't keep entities, everything else should survive
+	saved := s.Map()
+	original.Entities = nil
+	if !reflect.DeepEqual(saved, original) {
+		t.Errorf("State didn't match the map it was built from. A: %v, E: %v", saved, original)
+	}
+}
+
+func TestMapValidation(t *testing.T) {
+	m := testMap()
+	m.Heights[2][3] = -1
+	var tileErr *TileError
+	if err := m.Validate(); !errors.As(err, &tileErr) || tileErr.Pos != (Coordinates{3, 2}) {
+		t.Errorf("Bad height wasn't blamed on its tile. Err: %v", err)
+	}
+
+	m = testMap()
+	m.Entities = append(m.Entities, MapEntity{Kind: "dragon", Pos: Coordinates{0, 1}})
+	if err := m.Validate(); !errors.As(err, &tileErr) || tileErr.Pos != (Coordinates{0, 1}) {
+		t.Errorf("Unknown entity wasn't blamed on its tile. Err: %v", err)
+	}
+
+	m = testMap()
+	m.Heights = m.Heights[:3]
+	if err := m.Validate(); err == nil {
+		t.Errorf("Map missing a row passed validation")
+	}
+}
@@ -3,19 +3,39 @@ package state
 import (
 	"encoding/json"
 	"fmt"
+	"math/rand"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/VivaLaPanda/antipath/entity"
 	"github.com/VivaLaPanda/antipath/state/tile"
 	uuid "github.com/satori/go.uuid"
 )
 
+// State is the world grid and where everything on it is. A State belongs to
+// whoever is simulating it and isn't safe to read while it's being changed.
+// Other goroutines should be handed a snapshot from PeekState instead, which
+// never changes.
 type State struct {
+	tick         uint64
 	grid         [][]tile.Tile
 	root         Coordinates
 	size         int
 	entities     map[entity.ID]Coordinates
 	entitiesLock *sync.RWMutex
+	// Source of entity IDs. Guarded by entitiesLock
+	rand *rand.Rand
+	// Where the totems are, and the tiles they pulled on last time
+	totems     map[Coordinates]bool
+	influenced map[Coordinates]int
+	// Where players are allowed to spawn. Empty means anywhere
+	spawnPoints []Coordinates
+	// The last frame PeekState cut snapshots from, which rows have changed
+	// since, and whether anything has. See frame.go
+	frame      *frame
+	dirty      []bool
+	frameStale bool
 }
 
 // 2D coordinate pair. References a cell in `grid`
@@ -28,14 +48,20 @@ type Direction int
 
 // This const is like an enum. So Up is 0, Right is 1, etc.
 const (
-	Up    Direction = iota
-	Right Direction = iota
-	Left  Direction = iota
-	Down  Direction = iota
-	MovNone  Direction = iota
+	Up      Direction = iota
+	Right   Direction = iota
+	Left    Direction = iota
+	Down    Direction = iota
+	MovNone Direction = iota
 )
 
 func NewState(size int) (grid *State) {
+	return NewSeededState(size, time.Now().UnixNano())
+}
+
+// Makes a new state whose entity IDs are derived from `seed`, so two states
+// built with the same seed and fed the same operations come out identical
+func NewSeededState(size int, seed int64) (grid *State) {
 	if size < 1 {
 		panic("state must be at least 1x1 size")
 	}
@@ -49,6 +75,9 @@ func NewState(size int) (grid *State) {
 		size:         size, // faster than using len every time
 		entities:     make(map[entity.ID]Coordinates),
 		entitiesLock: &sync.RWMutex{},
+		rand:         rand.New(rand.NewSource(seed)),
+		totems:       make(map[Coordinates]bool),
+		dirty:        make([]bool, size),
 	}
 }
 
@@ -59,10 +88,12 @@ func (state *State) MarshalJSON() ([]byte, error) {
 	}
 
 	return json.Marshal(&struct {
+		Tick     uint64                    `json:"tick"`
 		Grid     [][]tile.Tile             `json:"grid"`
 		Entities map[entity.ID]Coordinates `json:"entities"`
 		Root     Coordinates               `json:"root"`
 	}{
+		Tick:     state.Tick(),
 		Grid:     state.grid,
 		Entities: state.entities,
 		Root:     state.root,
@@ -73,10 +104,55 @@ func (s *State) Size() int {
 	return s.size
 }
 
+// Where players may be spawned into the world. Empty means anywhere
+func (s *State) SpawnPoints() []Coordinates {
+	return s.spawnPoints
+}
+
+func (s *State) SetSpawnPoints(points []Coordinates) {
+	s.spawnPoints = points
+}
+
+// Where the top left corner of this state sits in the full world. Always 0,0
+// unless the state came from PeekState
+func (s *State) Root() Coordinates {
+	return s.root
+}
+
+// The number of the last simulation tick applied to this state.
+// Snapshots from PeekState carry the tick they were taken at
+func (s *State) Tick() uint64 {
+	return atomic.LoadUint64(&s.tick)
+}
+
+// Moves the state on to the next tick and returns the new tick number
+func (s *State) AdvanceTick() uint64 {
+	return atomic.AddUint64(&s.tick, 1)
+}
+
+// Jumps the state straight to `tick`, for picking a world back up where it
+// left off
+func (s *State) SetTick(tick uint64) {
+	atomic.StoreUint64(&s.tick, tick)
+}
+
+// The tile at `pos`, to change as you like
 func (s *State) GetTile(pos Coordinates) (*tile.Tile, error) {
 	if outOfBounds(s.size, pos) {
 		return nil, fmt.Errorf("provided pos is out of bounds. Pos: %v, maxsize: %d", pos, s.size)
 	}
+	s.markDirty(pos.Y)
+
+	return &s.grid[pos.Y][pos.X], nil
+}
+
+// Like GetTile, but only for looking. Changes made through it won't show up
+// in snapshots from PeekState.
+func (s *State) PeekTile(pos Coordinates) (*tile.Tile, error) {
+	if outOfBounds(s.size, pos) {
+		return nil, fmt.Errorf("provided pos is out of bounds. Pos: %v, maxsize: %d", pos, s.size)
+	}
+
 	return &s.grid[pos.Y][pos.X], nil
 }
 
@@ -90,15 +166,64 @@ func (s *State) NewEntity(data entity.Entity, pos Coordinates) (id entity.ID, er
 		return "", fmt.Errorf("provided pos can't contain an entity, already full. Tile %v", targetTile)
 	}
 
-	id = entity.ID(uuid.Must(uuid.NewV4()).String())
-
 	s.entitiesLock.Lock()
+	id = s.newID()
 	s.entities[id] = pos
 	s.entitiesLock.Unlock()
 
 	return id, nil
 }
 
+// Puts an entity back into the state under an ID it already has, like a
+// player coming back after being removed
+func (s *State) PlaceEntity(id entity.ID, data entity.Entity, pos Coordinates) error {
+	targetTile, err := s.GetTile(pos)
+	if err != nil {
+		return err
+	}
+
+	s.entitiesLock.Lock()
+	defer s.entitiesLock.Unlock()
+	if _, exists := s.entities[id]; exists {
+		return fmt.Errorf("provided entity ID is already in the state. ID: %s", id)
+	}
+	if err := targetTile.SetEntity(data); err != nil {
+		return fmt.Errorf("provided pos can't contain an entity, already full. Tile %v", targetTile)
+	}
+	s.entities[id] = pos
+
+	return nil
+}
+
+// Mints a random v4 UUID from the state's own random source. Callers must
+// hold entitiesLock
+func (s *State) newID() entity.ID {
+	var id uuid.UUID
+	s.rand.Read(id[:])
+	id.SetVersion(uuid.V4)
+	id.SetVariant(uuid.VariantRFC4122)
+
+	return entity.ID(id.String())
+}
+
+// Takes an entity out of the state entirely, returning its data
+func (s *State) RemoveEntity(entityID entity.ID) (data entity.Entity, err error) {
+	s.entitiesLock.Lock()
+	defer s.entitiesLock.Unlock()
+
+	pos, exists := s.entities[entityID]
+	if !exists {
+		return nil, fmt.Errorf("provided entity ID not valid. ID: %s", entityID)
+	}
+	entityTile, err := s.GetTile(pos)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get tile at entity pos, pos: %v, err: %s", pos, err)
+	}
+
+	delete(s.entities, entityID)
+	return entityTile.PopEntity(), nil
+}
+
 func (s *State) GetEntityPos(entityID entity.ID) (pos Coordinates, exists bool) {
 	s.entitiesLock.RLock()
 	pos, exists = s.entities[entityID]
@@ -106,38 +231,79 @@ func (s *State) GetEntityPos(entityID entity.ID) (pos Coordinates, exists bool)
 	return
 }
 
-func (s *State) PeekState(entityID entity.ID, windowSize int) *State {
-	stateFragment := &State{}
-	stateFragment.entities = make(map[entity.ID]Coordinates)
+// Calls `fn` with every tile in the state, in reading order, along with
+// where that tile is in the full world. Tiles in a snapshot from PeekState
+// are shared with other snapshots, so `fn` mustn't change them.
+func (s *State) EachTile(fn func(pos Coordinates, t *tile.Tile)) {
+	for y, row := range s.grid {
+		s.markDirty(y)
+		for x := range row {
+			fn(Coordinates{s.root.X + x, s.root.Y + y}, &row[x])
+		}
+	}
+}
+
+// A copy of where every entity in the state is
+func (s *State) Entities() map[entity.ID]Coordinates {
+	if s.entitiesLock != nil {
+		s.entitiesLock.RLock()
+		defer s.entitiesLock.RUnlock()
+	}
+
+	entities := make(map[entity.ID]Coordinates, len(s.entities))
+	for id, pos := range s.entities {
+		entities[id] = pos
+	}
+
+	return entities
+}
 
+func (s *State) PeekState(entityID entity.ID, windowSize int) *State {
 	// Expand a window around the entity
 	s.entitiesLock.RLock()
-	pos := s.entities[entityID]
+	pos, exists := s.entities[entityID]
 	s.entitiesLock.RUnlock()
 
+	stateFragment := s.PeekStateAt(pos, windowSize)
+
+	// Make sure the current player is in the entity list
+	if exists {
+		stateFragment.entities[entityID] = pos
+	}
+
+	return stateFragment
+}
+
+// Like PeekState, but centred on a position instead of an entity. The
+// snapshot is cut from a frozen frame of the world, entities and all, so it
+// can be read from any goroutine while this state carries on changing. It's
+// cheap to take lots of them, as they share the frame's tiles.
+func (s *State) PeekStateAt(pos Coordinates, windowSize int) *State {
+	frame := s.currentFrame()
+	stateFragment := &State{}
+	stateFragment.tick = frame.tick
+	stateFragment.entities = make(map[entity.ID]Coordinates)
+
 	minX := forceBounds(pos.X-(windowSize/2), s.size)
 	minY := forceBounds(pos.Y-(windowSize/2), s.size)
 	maxX := forceBounds(pos.X+(windowSize/2), s.size)
 	maxY := forceBounds(pos.Y+(windowSize/2), s.size)
 	stateFragment.root = Coordinates{minX, minY}
 
-	// Grab the part of the grid described by the bounds above
-	ySlice := s.grid[minY:maxY]
-	gridCopy := make([][]tile.Tile, len(ySlice))
+	// Grab the part of the frame described by the bounds above. The rows are
+	// capped so nothing can append into the frame's tiles
+	ySlice := frame.rows[minY:maxY]
+	gridWindow := make([][]tile.Tile, len(ySlice))
 	for idy, row := range ySlice {
-		gridCopy[idy] = row[minX:maxX]
-		for idx, tile := range gridCopy[idy] {
-			entity := tile.PeekEntity()
-			if entity != nil {
-				stateFragment.entities[entity.ID()] = Coordinates{minX + idx, minY + idy}
-			}
+		gridWindow[idy] = row[minX:maxX:maxX]
+	}
+	for entityID, entityPos := range frame.entities {
+		if entityPos.X >= minX && entityPos.X < maxX && entityPos.Y >= minY && entityPos.Y < maxY {
+			stateFragment.entities[entityID] = entityPos
 		}
 	}
 
-	stateFragment.grid = gridCopy
-
-	// Make sure the current player is in the entity list
-	stateFragment.entities[entityID] = pos
+	stateFragment.grid = gridWindow
 
 	return stateFragment
 }
@@ -180,19 +346,25 @@ func (s *State) Move(entityID entity.ID, dir Direction, speed int, altitude int)
 	}
 
 	// Calculate the total movement
-	targetPos := sourcePos
+	targetPos := Offset(sourcePos, dir, speed)
+
+	return s.ChangePos(entityID, targetPos, altitude)
+}
+
+// The position `distance` tiles away from `pos` in direction `dir`
+func Offset(pos Coordinates, dir Direction, distance int) Coordinates {
 	switch dir {
 	case Up:
-		targetPos.Y -= speed
+		pos.Y -= distance
 	case Down:
-		targetPos.Y += speed
+		pos.Y += distance
 	case Left:
-		targetPos.X -= speed
+		pos.X -= distance
 	case Right:
-		targetPos.X += speed
+		pos.X += distance
 	}
 
-	return s.ChangePos(entityID, targetPos, altitude)
+	return pos
 }
 
 func abs(a int) int {
@@ -232,7 +404,7 @@ func (s *State) moveCollider(sourcePos Coordinates, targetPos Coordinates, altit
 		}
 
 		// Get tile data for where we moved to
-		checkTile, err := s.GetTile(checkPos)
+		checkTile, err := s.PeekTile(checkPos)
 		if err != nil {
 			return result
 		}
@@ -16,6 +16,21 @@ func TestNewState(t *testing.T) {
 	NewState(100)
 }
 
+func TestNewSeededState(t *testing.T) {
+	stateA := NewSeededState(10, 7)
+	stateB := NewSeededState(10, 7)
+	idA, _ := stateA.NewEntity(player.NewPlayer(), Coordinates{1, 1})
+	idB, _ := stateB.NewEntity(player.NewPlayer(), Coordinates{1, 1})
+	if idA != idB {
+		t.Errorf("States with the same seed minted different IDs. A: %s, B: %s", idA, idB)
+	}
+
+	otherID, _ := stateA.NewEntity(player.NewPlayer(), Coordinates{2, 2})
+	if otherID == idA {
+		t.Errorf("State minted the same ID twice: %s", otherID)
+	}
+}
+
 func TestMarshallJson(t *testing.T) {
 	testState := NewState(100)
 
@@ -59,6 +74,54 @@ func TestNewEntity(t *testing.T) {
 	}
 }
 
+func TestRemoveEntity(t *testing.T) {
+	testState := NewState(100)
+	pos := Coordinates{3, 4}
+	testPlayer := player.NewPlayer()
+	playerID, _ := testState.NewEntity(testPlayer, pos)
+
+	removed, err := testState.RemoveEntity(playerID)
+	if err != nil {
+		t.Errorf("Removing a valid entity produced an error: %v", err)
+	}
+	if removed != testPlayer {
+		t.Errorf("Removing an entity didn't return its data")
+	}
+	if _, exists := testState.GetEntityPos(playerID); exists {
+		t.Errorf("Removed entity still has a position")
+	}
+	tile, _ := testState.GetTile(pos)
+	if tile.PeekEntity() != nil {
+		t.Errorf("Removed entity is still on its tile")
+	}
+
+	_, err = testState.RemoveEntity(playerID)
+	if err == nil {
+		t.Errorf("Removing an entity twice didn't produce an error")
+	}
+}
+
+func TestPlaceEntity(t *testing.T) {
+	testState := NewState(100)
+	testPlayer := player.NewPlayer()
+	playerID, _ := testState.NewEntity(testPlayer, Coordinates{1, 1})
+
+	err := testState.PlaceEntity(playerID, testPlayer, Coordinates{2, 2})
+	if err == nil {
+		t.Errorf("Placing an entity that's already in the state didn't produce an error")
+	}
+
+	testState.RemoveEntity(playerID)
+	err = testState.PlaceEntity(playerID, testPlayer, Coordinates{2, 2})
+	if err != nil {
+		t.Errorf("Placing a removed entity back produced an error: %v", err)
+	}
+	pos, _ := testState.GetEntityPos(playerID)
+	if pos != (Coordinates{2, 2}) {
+		t.Errorf("Placed entity is in the wrong position. A: %v, E: %v", pos, Coordinates{2, 2})
+	}
+}
+
 func TestGetEntityPos(t *testing.T) {
 	testState := NewState(100)
 	pos := Coordinates{0, 0}
@@ -87,6 +150,31 @@ func TestPeekState(t *testing.T) {
 	}
 }
 
+func TestPeekStateIsCopy(t *testing.T) {
+	testState := NewState(20)
+	pos := Coordinates{10, 10}
+	testPlayer := player.NewPlayer()
+	playerID, _ := testState.NewEntity(testPlayer, pos)
+
+	stateFrag := testState.PeekState(playerID, 10)
+	testPlayer.Damage(50)
+	testState.ChangePos(playerID, Coordinates{11, 10}, testPlayer.Altitude)
+	testState.grid[10][10].SetHeight(3)
+
+	// The window starts at 5,5
+	peeked := &stateFrag.grid[5][5]
+	if peeked.TerrainHeight() != 0 {
+		t.Errorf("Peeked tile changed with the original. A: %d, E: 0", peeked.TerrainHeight())
+	}
+	peekedPlayer, ok := peeked.PeekEntity().(*player.Player)
+	if !ok {
+		t.Fatalf("Peeked tile lost its player when the original moved")
+	}
+	if peekedPlayer == testPlayer || peekedPlayer.Health != 100 {
+		t.Errorf("Peeked player changed with the original. A: %d, E: 100", peekedPlayer.Health)
+	}
+}
+
 func TestMove(t *testing.T) {
 	testState := NewState(100)
 	pos := Coordinates{50, 50}
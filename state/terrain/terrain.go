@@ -0,0 +1,286 @@
+package terrain
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+// Params control what kind of world Generate builds
+type Params struct {
+	// Tallest a hill gets. 0 leaves the ground flat
+	HillHeight int
+	// Roughly how many tiles across a hill is
+	HillScale int
+	// How many walled rooms to carve out. Rooms are joined up by corridors
+	Rooms       int
+	RoomMinSize int
+	RoomMaxSize int
+	// How tall walls are. Anything this tall or taller can't be walked on
+	WallHeight int
+}
+
+// Named sets of params for picking a world style from the command line
+var Presets = map[string]Params{
+	"flat":    {},
+	"hills":   {HillHeight: 6, HillScale: 12},
+	"dungeon": {Rooms: 12, RoomMinSize: 5, RoomMaxSize: 12, WallHeight: 20},
+	"mixed":   {HillHeight: 4, HillScale: 12, Rooms: 6, RoomMinSize: 5, RoomMaxSize: 10, WallHeight: 20},
+}
+
+// Looks up a preset by name
+func Preset(name string) (Params, error) {
+	params, exists := Presets[name]
+	if !exists {
+		return Params{}, fmt.Errorf("no terrain preset called %q", name)
+	}
+
+	return params, nil
+}
+
+func (p Params) validate(size int) error {
+	if p.HillHeight < 0 {
+		return fmt.Errorf("hill height can't be negative, got %d", p.HillHeight)
+	}
+	if p.HillHeight > 0 && p.HillScale < 1 {
+		return fmt.Errorf("hills need a scale of at least 1, got %d", p.HillScale)
+	}
+	if p.Rooms > 0 {
+		if p.RoomMinSize < 3 || p.RoomMaxSize < p.RoomMinSize {
+			return fmt.Errorf("rooms need 3 <= min size <= max size, got %d and %d", p.RoomMinSize, p.RoomMaxSize)
+		}
+		if p.RoomMaxSize+2 > size {
+			return fmt.Errorf("rooms of size %d don't fit in a world of size %d", p.RoomMaxSize, size)
+		}
+		if p.WallHeight <= p.HillHeight+1 {
+			return fmt.Errorf("walls must be more than 1 taller than the hills, got %d for hills of %d", p.WallHeight, p.HillHeight)
+		}
+	}
+
+	return nil
+}
+
+// Fills `s` with terrain built from `seed` and `params`, overwriting any
+// heights already there. The same seed and params always build the same
+// terrain. Afterwards the state's spawn points are set to the largest area of
+// the world players can walk around, so everyone spawns somewhere they can
+// reach everyone else from.
+func Generate(s *state.State, seed int64, params Params) error {
+	if err := params.validate(s.Size()); err != nil {
+		return err
+	}
+	rng := rand.New(rand.NewSource(seed))
+	heights := make([][]int, s.Size())
+	for y := range heights {
+		heights[y] = make([]int, s.Size())
+	}
+
+	if params.HillHeight > 0 {
+		hills(heights, rng, params)
+	}
+	if params.Rooms > 0 {
+		rooms(heights, rng, params)
+	}
+
+	for y, row := range heights {
+		for x, height := range row {
+			groundTile, _ := s.GetTile(state.Coordinates{X: x, Y: y})
+			groundTile.SetHeight(height)
+		}
+	}
+	s.SetSpawnPoints(largestRegion(heights, params))
+
+	return nil
+}
+
+// Rolling hills from value noise. Random heights are picked on a coarse
+// lattice and smoothly blended between.
+func hills(heights [][]int, rng *rand.Rand, params Params) {
+	size := len(heights)
+	latticeSize := size/params.HillScale + 2
+	lattice := make([][]float64, latticeSize)
+	for idx := range lattice {
+		lattice[idx] = make([]float64, latticeSize)
+		for jdx := range lattice[idx] {
+			lattice[idx][jdx] = rng.Float64()
+		}
+	}
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			gx, gy := x/params.HillScale, y/params.HillScale
+			fx := smoothstep(float64(x%params.HillScale) / float64(params.HillScale))
+			fy := smoothstep(float64(y%params.HillScale) / float64(params.HillScale))
+
+			top := lerp(lattice[gy][gx], lattice[gy][gx+1], fx)
+			bottom := lerp(lattice[gy+1][gx], lattice[gy+1][gx+1], fx)
+			noise := lerp(top, bottom, fy)
+
+			heights[y][x] = int(noise * float64(params.HillHeight+1))
+			if heights[y][x] > params.HillHeight {
+				heights[y][x] = params.HillHeight
+			}
+		}
+	}
+}
+
+func smoothstep(t float64) float64 {
+	return t * t * (3 - 2*t)
+}
+
+func lerp(a float64, b float64, t float64) float64 {
+	return a + (b-a)*t
+}
+
+type room struct {
+	minX, minY, maxX, maxY int
+}
+
+func (r room) center() state.Coordinates {
+	return state.Coordinates{X: (r.minX + r.maxX) / 2, Y: (r.minY + r.maxY) / 2}
+}
+
+// Walled rooms with flat floors, strung together by corridors that ramp
+// gently enough to walk along
+func rooms(heights [][]int, rng *rand.Rand, params Params) {
+	size := len(heights)
+	placed := make([]room, 0, params.Rooms)
+	for idx := 0; idx < params.Rooms; idx++ {
+		width := params.RoomMinSize + rng.Intn(params.RoomMaxSize-params.RoomMinSize+1)
+		height := params.RoomMinSize + rng.Intn(params.RoomMaxSize-params.RoomMinSize+1)
+		newRoom := room{minX: 1 + rng.Intn(size-width-1), minY: 1 + rng.Intn(size-height-1)}
+		newRoom.maxX = newRoom.minX + width - 1
+		newRoom.maxY = newRoom.minY + height - 1
+
+		center := newRoom.center()
+		floor := heights[center.Y][center.X]
+		for y := newRoom.minY; y <= newRoom.maxY; y++ {
+			for x := newRoom.minX; x <= newRoom.maxX; x++ {
+				onEdge := x == newRoom.minX || x == newRoom.maxX || y == newRoom.minY || y == newRoom.maxY
+				if onEdge {
+					heights[y][x] = params.WallHeight
+				} else {
+					heights[y][x] = floor
+				}
+			}
+		}
+		placed = append(placed, newRoom)
+	}
+
+	for idx := 1; idx < len(placed); idx++ {
+		corridor(heights, placed[idx-1].center(), placed[idx].center(), params)
+	}
+}
+
+// Carves an L shaped corridor from `from` to `to`. The corridor follows the
+// lie of the land, but never steps up or down by more than 1, and knocks a
+// doorway through any wall it meets.
+func corridor(heights [][]int, from state.Coordinates, to state.Coordinates, params Params) {
+	current := heights[from.Y][from.X]
+	pos := from
+	for pos != to {
+		if pos.X != to.X {
+			pos.X += sign(to.X - pos.X)
+		} else {
+			pos.Y += sign(to.Y - pos.Y)
+		}
+
+		target := heights[pos.Y][pos.X]
+		if target >= params.WallHeight {
+			target = current
+		}
+		current += clamp(target-current, -1, 1)
+		heights[pos.Y][pos.X] = current
+	}
+}
+
+// Finds the largest group of walkable tiles a player could get between in
+// both directions, which means no wall tiles and no step of more than 1 up.
+func largestRegion(heights [][]int, params Params) []state.Coordinates {
+	size := len(heights)
+	walkable := func(pos state.Coordinates) bool {
+		return params.WallHeight == 0 || heights[pos.Y][pos.X] < params.WallHeight
+	}
+
+	visited := make([][]bool, size)
+	for idx := range visited {
+		visited[idx] = make([]bool, size)
+	}
+
+	var largest []state.Coordinates
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			start := state.Coordinates{X: x, Y: y}
+			if visited[y][x] || !walkable(start) {
+				continue
+			}
+
+			// Flood fill out from here
+			region := []state.Coordinates{start}
+			visited[y][x] = true
+			for next := 0; next < len(region); next++ {
+				pos := region[next]
+				for _, dir := range []state.Direction{state.Up, state.Right, state.Left, state.Down} {
+					neighbour := state.Offset(pos, dir, 1)
+					if neighbour.X < 0 || neighbour.Y < 0 || neighbour.X >= size || neighbour.Y >= size {
+						continue
+					}
+					if visited[neighbour.Y][neighbour.X] || !walkable(neighbour) {
+						continue
+					}
+					if abs(heights[neighbour.Y][neighbour.X]-heights[pos.Y][pos.X]) > 1 {
+						continue
+					}
+					visited[neighbour.Y][neighbour.X] = true
+					region = append(region, neighbour)
+				}
+			}
+
+			if len(region) > len(largest) {
+				largest = region
+			}
+		}
+	}
+
+	// Reading order, so it doesn't depend on where the fill started
+	sort.Slice(largest, func(i, j int) bool {
+		if largest[i].Y != largest[j].Y {
+			return largest[i].Y < largest[j].Y
+		}
+		return largest[i].X < largest[j].X
+	})
+
+	return largest
+}
+
+func sign(a int) int {
+	switch {
+	case a > 0:
+		return 1
+	case a < 0:
+		return -1
+	}
+
+	return 0
+}
+
+func clamp(a int, min int, max int) int {
+	if a < min {
+		return min
+	}
+	if a > max {
+		return max
+	}
+
+	return a
+}
+
+func abs(a int) int {
+	if a < 0 {
+		return -a
+	}
+
+	return a
+}
@@ -0,0 +1,99 @@
+package terrain
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/VivaLaPanda/antipath/state"
+)
+
+func TestGenerate(t *testing.T) {
+	for name, params := range Presets {
+		testState := state.NewState(60)
+		if err := Generate(testState, 11, params); err != nil {
+			t.Errorf("Generating %s terrain produced an error: %v", name, err)
+			continue
+		}
+
+		spawns := testState.SpawnPoints()
+		if len(spawns) == 0 {
+			t.Errorf("%s terrain has nowhere to spawn", name)
+			continue
+		}
+
+		// Every spawn point must be reachable from every other one
+		isSpawn := make(map[state.Coordinates]bool)
+		for _, pos := range spawns {
+			isSpawn[pos] = true
+		}
+		reached := map[state.Coordinates]bool{spawns[0]: true}
+		queue := []state.Coordinates{spawns[0]}
+		for len(queue) > 0 {
+			pos := queue[0]
+			queue = queue[1:]
+			here, _ := testState.GetTile(pos)
+			for _, dir := range []state.Direction{state.Up, state.Right, state.Left, state.Down} {
+				next := state.Offset(pos, dir, 1)
+				there, err := testState.GetTile(next)
+				if err != nil || reached[next] || !isSpawn[next] {
+					continue
+				}
+				if abs(there.TerrainHeight()-here.TerrainHeight()) > 1 {
+					continue
+				}
+				reached[next] = true
+				queue = append(queue, next)
+			}
+		}
+		if len(reached) != len(spawns) {
+			t.Errorf("%s terrain has spawn points that can't reach each other. Reached %d of %d", name, len(reached), len(spawns))
+		}
+	}
+}
+
+func TestGenerateHasTerrain(t *testing.T) {
+	testState := state.NewState(60)
+	Generate(testState, 3, Presets["mixed"])
+
+	tallest := 0
+	for y := 0; y < testState.Size(); y++ {
+		for x := 0; x < testState.Size(); x++ {
+			ground, _ := testState.GetTile(state.Coordinates{X: x, Y: y})
+			if ground.TerrainHeight() > tallest {
+				tallest = ground.TerrainHeight()
+			}
+		}
+	}
+	if tallest != Presets["mixed"].WallHeight {
+		t.Errorf("Mixed terrain has no walls. Tallest tile: %d", tallest)
+	}
+}
+
+func TestGenerateDeterministic(t *testing.T) {
+	stateA := state.NewSeededState(40, 1)
+	stateB := state.NewSeededState(40, 1)
+	Generate(stateA, 99, Presets["mixed"])
+	Generate(stateB, 99, Presets["mixed"])
+
+	jsonA, _ := stateA.MarshalJSON()
+	jsonB, _ := stateB.MarshalJSON()
+	if !bytes.Equal(jsonA, jsonB) {
+		t.Errorf("Same seed and params generated different terrain")
+	}
+}
+
+func TestGenerateBadParams(t *testing.T) {
+	testState := state.NewState(20)
+
+	err := Generate(testState, 1, Params{Rooms: 1, RoomMinSize: 5, RoomMaxSize: 30, WallHeight: 10})
+	if err == nil {
+		t.Errorf("Rooms bigger than the world didn't produce an error")
+	}
+	err = Generate(testState, 1, Params{HillHeight: 5})
+	if err == nil {
+		t.Errorf("Hills without a scale didn't produce an error")
+	}
+	if _, err := Preset("nonsense"); err == nil {
+		t.Errorf("Looking up a missing preset didn't produce an error")
+	}
+}
@@ -7,6 +7,13 @@ import (
 	"github.com/VivaLaPanda/antipath/entity"
 )
 
+const (
+	// Alignment can't go further than this in either direction
+	MaxAlignment = 100
+	// How much damage a fresh totem can take
+	MaxTotemHealth = 100
+)
+
 type Tile struct {
 	alignment int
 	entity    entity.Entity
@@ -30,6 +37,30 @@ func (tile *Tile) MarshalJSON() ([]byte, error) {
 	})
 }
 
+// A copy of the tile and whatever is on it, which won't change as the
+// original does
+func (tile *Tile) Copy() Tile {
+	copied := *tile
+	if tile.entity != nil {
+		copied.entity = tile.entity.Copy()
+	}
+
+	return copied
+}
+
+// Whether the two tiles look the same to clients, i.e. whether they'd
+// marshal the same
+func (tile *Tile) Equal(other *Tile) bool {
+	if tile.alignment != other.alignment || tile.height != other.height || tile.totemHealth != other.totemHealth {
+		return false
+	}
+	if tile.entity == nil || other.entity == nil {
+		return tile.entity == other.entity
+	}
+
+	return tile.entity.Equal(other.entity)
+}
+
 func (tile *Tile) SetEntity(entity entity.Entity) error {
 	if tile.entity != nil {
 		return fmt.Errorf("can only SetEntity if entity is already nil, remove before setting")
@@ -50,6 +81,15 @@ func (tile *Tile) PeekEntity() entity.Entity {
 	return tile.entity
 }
 
+// Height of the ground itself, ignoring anything standing on it
+func (tile *Tile) TerrainHeight() int {
+	return tile.height
+}
+
+func (tile *Tile) SetHeight(height int) {
+	tile.height = height
+}
+
 func (tile *Tile) Height() int {
 	if tile.entity != nil {
 		return tile.height + tile.entity.Height()
@@ -57,6 +97,72 @@ func (tile *Tile) Height() int {
 	return tile.height
 }
 
+func (tile *Tile) Alignment() int {
+	return tile.alignment
+}
+
+func (tile *Tile) SetAlignment(alignment int) {
+	tile.alignment = clampAlignment(alignment)
+}
+
+// How much the tile's alignment changed by on the last alignment update
+func (tile *Tile) AlignmentDelta() int {
+	return tile.alignmentDelta
+}
+
+// Shifts the tile's alignment by `delta`, remembering the change
+func (tile *Tile) ShiftAlignment(delta int) {
+	before := tile.alignment
+	tile.alignment = clampAlignment(tile.alignment + delta)
+	tile.alignmentDelta = tile.alignment - before
+}
+
+func clampAlignment(alignment int) int {
+	if alignment > MaxAlignment {
+		return MaxAlignment
+	}
+	if alignment < -MaxAlignment {
+		return -MaxAlignment
+	}
+
+	return alignment
+}
+
+func (tile *Tile) HasTotem() bool {
+	return tile.totemHealth > 0
+}
+
+func (tile *Tile) TotemHealth() int {
+	return tile.totemHealth
+}
+
+// Puts a totem on the tile which pins the tile to `alignment`
+func (tile *Tile) PlaceTotem(alignment int) error {
+	if tile.HasTotem() {
+		return fmt.Errorf("tile already has a totem, destroy it before placing another")
+	}
+	tile.totemHealth = MaxTotemHealth
+	tile.SetAlignment(alignment)
+	tile.alignmentDelta = 0
+
+	return nil
+}
+
+// Knocks `amount` off the totem's health. Returns true if that destroyed it
+func (tile *Tile) DamageTotem(amount int) (destroyed bool) {
+	if !tile.HasTotem() {
+		return false
+	}
+
+	tile.totemHealth -= amount
+	if tile.totemHealth <= 0 {
+		tile.totemHealth = 0
+		return true
+	}
+
+	return false
+}
+
 func (tile *Tile) WillCollide(altitude int) bool {
 	return altitude <= tile.Height()
 }
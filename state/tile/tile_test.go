@@ -78,3 +78,83 @@ func TestWillCollide(t *testing.T) {
 		t.Errorf("A 0 height tile with a 10 height player should not collide with a 15 elevation object")
 	}
 }
+
+func TestTerrainHeight(t *testing.T) {
+	testTile := Tile{}
+	testTile.SetHeight(3)
+	testTile.SetEntity(player.NewPlayer())
+
+	if testTile.TerrainHeight() != 3 {
+		t.Errorf("Terrain height wrong. A: %d, E: %d", testTile.TerrainHeight(), 3)
+	}
+	if testTile.Height() != 3+testTile.PeekEntity().Height() {
+		t.Errorf("Tile height doesn't include what's standing on it. A: %d", testTile.Height())
+	}
+}
+
+func TestShiftAlignment(t *testing.T) {
+	testTile := Tile{}
+
+	testTile.ShiftAlignment(30)
+	if testTile.Alignment() != 30 || testTile.AlignmentDelta() != 30 {
+		t.Errorf("Alignment shift not applied. Alignment: %d, Delta: %d", testTile.Alignment(), testTile.AlignmentDelta())
+	}
+
+	// Can't go past the max, and the delta shows what actually changed
+	testTile.ShiftAlignment(1000)
+	if testTile.Alignment() != MaxAlignment || testTile.AlignmentDelta() != MaxAlignment-30 {
+		t.Errorf("Alignment not clamped. Alignment: %d, Delta: %d", testTile.Alignment(), testTile.AlignmentDelta())
+	}
+}
+
+func TestTotem(t *testing.T) {
+	testTile := Tile{}
+
+	if err := testTile.PlaceTotem(-MaxAlignment); err != nil {
+		t.Errorf("Placing a totem on an empty tile produced an error: %v", err)
+	}
+	if !testTile.HasTotem() || testTile.Alignment() != -MaxAlignment {
+		t.Errorf("Totem wasn't placed properly. %v", testTile)
+	}
+	if err := testTile.PlaceTotem(MaxAlignment); err == nil {
+		t.Errorf("Placing a second totem didn't produce an error")
+	}
+
+	if testTile.DamageTotem(MaxTotemHealth - 1) {
+		t.Errorf("Totem destroyed before its health ran out")
+	}
+	if !testTile.DamageTotem(10) {
+		t.Errorf("Totem not destroyed after its health ran out")
+	}
+	if testTile.HasTotem() || testTile.TotemHealth() != 0 {
+		t.Errorf("Destroyed totem is still there. Health: %d", testTile.TotemHealth())
+	}
+}
+
+func TestEqual(t *testing.T) {
+	original := Tile{}
+	original.SetHeight(2)
+	original.SetEntity(player.NewPlayer())
+
+	copied := original.Copy()
+	if !original.Equal(&copied) {
+		t.Errorf("Copy of a tile isn't equal to it")
+	}
+
+	copied.PeekEntity().(*player.Player).Health--
+	if original.Equal(&copied) {
+		t.Errorf("Tiles with different players are equal")
+	}
+
+	copied = original.Copy()
+	copied.PopEntity()
+	if original.Equal(&copied) || copied.Equal(&original) {
+		t.Errorf("Tile with a player is equal to one without")
+	}
+
+	copied = original.Copy()
+	copied.ShiftAlignment(5)
+	if original.Equal(&copied) {
+		t.Errorf("Tiles with different alignments are equal")
+	}
+}
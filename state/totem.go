@@ -0,0 +1,110 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+)
+
+// How many tiles away a totem's influence reaches
+const TotemRadius = 5
+
+// Puts a totem on the tile at `pos`, pinning it to `alignment`
+func (s *State) PlaceTotem(pos Coordinates, alignment int) error {
+	totemTile, err := s.GetTile(pos)
+	if err != nil {
+		return err
+	}
+	if err := totemTile.PlaceTotem(alignment); err != nil {
+		return fmt.Errorf("can't place totem at %v, err: %s", pos, err)
+	}
+	s.totems[pos] = true
+
+	return nil
+}
+
+// Damages the totem at `pos`, returning whether that destroyed it
+func (s *State) DamageTotem(pos Coordinates, amount int) (destroyed bool, err error) {
+	totemTile, err := s.PeekTile(pos)
+	if err != nil {
+		return false, err
+	}
+	if !totemTile.HasTotem() {
+		return false, fmt.Errorf("no totem at %v", pos)
+	}
+	s.markDirty(pos.Y)
+
+	destroyed = totemTile.DamageTotem(amount)
+	if destroyed {
+		delete(s.totems, pos)
+	}
+
+	return destroyed, nil
+}
+
+// Where every standing totem is, in reading order
+func (s *State) Totems() []Coordinates {
+	totems := make([]Coordinates, 0, len(s.totems))
+	for pos := range s.totems {
+		totems = append(totems, pos)
+	}
+	sort.Slice(totems, func(i, j int) bool {
+		if totems[i].Y != totems[j].Y {
+			return totems[i].Y < totems[j].Y
+		}
+		return totems[i].X < totems[j].X
+	})
+
+	return totems
+}
+
+// Every totem pulls the tiles around it towards its alignment, harder the
+// closer they are. Where totems overlap their pulls add up, so opposing totems
+// cancel out. Tiles with totems on them don't budge.
+func (s *State) SpreadAlignment() {
+	deltas := make(map[Coordinates]int)
+	for totemPos := range s.totems {
+		totemTile, _ := s.PeekTile(totemPos)
+		pull := sign(totemTile.Alignment())
+		if pull == 0 {
+			continue
+		}
+
+		for dy := -TotemRadius; dy <= TotemRadius; dy++ {
+			for dx := -TotemRadius; dx <= TotemRadius; dx++ {
+				pos := Coordinates{totemPos.X + dx, totemPos.Y + dy}
+				distance := Distance(totemPos, pos)
+				if distance == 0 || distance > TotemRadius || outOfBounds(s.size, pos) {
+					continue
+				}
+				deltas[pos] += pull * (TotemRadius - distance + 1)
+			}
+		}
+	}
+
+	// Tiles that were being pulled last time but aren't any more settle down
+	for pos := range s.influenced {
+		if _, stillInfluenced := deltas[pos]; !stillInfluenced {
+			settledTile, _ := s.GetTile(pos)
+			settledTile.ShiftAlignment(0)
+		}
+	}
+	for pos, delta := range deltas {
+		influencedTile, _ := s.GetTile(pos)
+		if influencedTile.HasTotem() {
+			continue
+		}
+		influencedTile.ShiftAlignment(delta)
+	}
+	s.influenced = deltas
+}
+
+func sign(a int) int {
+	switch {
+	case a > 0:
+		return 1
+	case a < 0:
+		return -1
+	}
+
+	return 0
+}
@@ -0,0 +1,64 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/VivaLaPanda/antipath/state/tile"
+)
+
+func TestPlaceTotem(t *testing.T) {
+	testState := NewState(20)
+	pos := Coordinates{5, 5}
+
+	if err := testState.PlaceTotem(pos, tile.MaxAlignment); err != nil {
+		t.Errorf("Placing a totem produced an error: %v", err)
+	}
+	if err := testState.PlaceTotem(pos, tile.MaxAlignment); err == nil {
+		t.Errorf("Placing a totem on top of another didn't produce an error")
+	}
+	if totems := testState.Totems(); len(totems) != 1 || totems[0] != pos {
+		t.Errorf("Totem list is wrong. A: %v, E: %v", totems, []Coordinates{pos})
+	}
+
+	destroyed, err := testState.DamageTotem(pos, tile.MaxTotemHealth)
+	if err != nil || !destroyed {
+		t.Errorf("Totem wasn't destroyed. Destroyed: %v, Err: %v", destroyed, err)
+	}
+	if len(testState.Totems()) != 0 {
+		t.Errorf("Destroyed totem still listed")
+	}
+	if _, err := testState.DamageTotem(pos, 1); err == nil {
+		t.Errorf("Damaging a missing totem didn't produce an error")
+	}
+}
+
+func TestSpreadAlignment(t *testing.T) {
+	testState := NewState(20)
+	testState.PlaceTotem(Coordinates{5, 5}, tile.MaxAlignment)
+
+	testState.SpreadAlignment()
+	near, _ := testState.GetTile(Coordinates{5, 6})
+	far, _ := testState.GetTile(Coordinates{5, 5 + TotemRadius})
+	outside, _ := testState.GetTile(Coordinates{5, 6 + TotemRadius})
+	if near.AlignmentDelta() != TotemRadius || far.AlignmentDelta() != 1 {
+		t.Errorf("Totem pull doesn't fall off with distance. Near: %d, Far: %d", near.AlignmentDelta(), far.AlignmentDelta())
+	}
+	if outside.Alignment() != 0 {
+		t.Errorf("Totem pulled on a tile outside its radius. Alignment: %d", outside.Alignment())
+	}
+
+	// An opposing totem the same distance away cancels the pull out
+	testState.PlaceTotem(Coordinates{5, 7}, -tile.MaxAlignment)
+	testState.SpreadAlignment()
+	if near.AlignmentDelta() != 0 {
+		t.Errorf("Opposing totems didn't cancel out. Delta: %d", near.AlignmentDelta())
+	}
+
+	// Once the totems go the tiles settle
+	testState.DamageTotem(Coordinates{5, 5}, tile.MaxTotemHealth)
+	testState.DamageTotem(Coordinates{5, 7}, tile.MaxTotemHealth)
+	testState.SpreadAlignment()
+	if near.AlignmentDelta() != 0 || near.Alignment() != TotemRadius {
+		t.Errorf("Tile didn't settle after the totems went. Alignment: %d, Delta: %d", near.Alignment(), near.AlignmentDelta())
+	}
+}